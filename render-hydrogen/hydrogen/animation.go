@@ -0,0 +1,54 @@
+package hydrogen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the evenly spaced times of all frames.
+func (a *Animation) times() []float64 {
+	times := make([]float64, a.Frames)
+	for f := range times {
+		times[f] = a.StartTime + (a.EndTime-a.StartTime)*float64(f)/float64(a.Frames-1)
+	}
+	return times
+}
+
+// Returns the numbered file name of frame f, e.g., outputs/foo.png becomes outputs/foo-0003.png for f=3.
+func frameFile(outputFile string, f int) string {
+	ext := filepath.Ext(outputFile)
+	return fmt.Sprintf("%v-%04d%v", strings.TrimSuffix(outputFile, ext), f, ext)
+}
+
+// Writes all frames as an animated GIF with the given delay between frames in 100ths of a second.
+func writeGIF(cfg *Config, frames []*image.RGBA, filename string, delay int) error {
+	pal := color.Palette(palette.Plan9)
+	// Anaglyphs mix the colors of the two eyes, so they are not on the heatmap.
+	if cfg.ColorMode != phaseColorMode && (cfg.Stereo == nil || cfg.Stereo.Mode != anaglyphStereo) {
+		// GIF allows at most 256 colors, sample them evenly from the heatmap.
+		pal = make(color.Palette, 0, 256)
+		for k := 0; k < 256; k++ {
+			pal = append(pal, cfg.heatmap[k*(len(cfg.heatmap)-1)/255])
+		}
+	}
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		p := image.NewPaletted(frame.Bounds(), pal)
+		draw.FloydSteinberg.Draw(p, frame.Bounds(), frame, image.Point{})
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return gif.EncodeAll(out, anim)
+}
@@ -0,0 +1,147 @@
+package hydrogen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Appends the annotation panel below the image: the colorbar with the tone mapping curve, the state, the camera and
+// a scale bar. top is the probability density in a_0^-3 (or (hbar/a_0)^-3 in momentum space) at the top of the
+// heatmap, or Re psi in a_0^-3/2 for signed coloring, and phi and t are the camera azimuth in radians and the time of
+// the image.
+func annotate(cfg *Config, img *image.RGBA, top, phi, t float64) *image.RGBA {
+	w := img.Bounds().Dx()
+	scale := w / 300
+	if scale < 1 {
+		scale = 1
+	}
+	margin := 4 * scale
+	barHeight := 12 * scale
+	lineHeight := (glyphHeight + 3) * scale
+
+	labels := []string{stateLabel(cfg)}
+	camera := fmt.Sprintf("theta=%.4g phi=%.4g", cfg.CameraTheta/degToRad, phi/degToRad)
+	if cfg.CameraRoll != 0 {
+		camera += fmt.Sprintf(" roll=%.4g", cfg.CameraRoll/degToRad)
+	}
+	if cfg.Projection == perspectiveProjection {
+		camera += fmt.Sprintf(" perspective fov=%.4g", cfg.FOVAngle/degToRad)
+	}
+	if p := cfg.plane; p != nil {
+		camera = fmt.Sprintf("plane normal=(%.3g,%.3g,%.3g) offset=%.4g",
+			p.Normal[0], p.Normal[1], p.Normal[2], p.Offset)
+	}
+	labels = append(labels, camera)
+	if cfg.Animation != nil {
+		labels = append(labels, fmt.Sprintf("t=%.4g", t))
+	}
+
+	// Colorbar, its end labels, the other labels and the scale bar.
+	height := margin + barHeight + scale + lineHeight + len(labels)*lineHeight + lineHeight + margin
+	out := image.NewRGBA(image.Rect(0, 0, w, img.Bounds().Dy()+height))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(out, img.Bounds(), img, image.Point{}, draw.Src)
+	y := img.Bounds().Dy() + margin
+
+	// The colorbar spans the heatmap, except for phase coloring where it spans the phase at full brightness.
+	barWidth := w - 2*margin
+	for x := 0; x < barWidth; x++ {
+		frac := float64(x) / float64(barWidth-1)
+		var c color.RGBA64
+		if cfg.ColorMode == phaseColorMode {
+			c = phaseColor(-math.Pi+2*math.Pi*frac, 1)
+		} else {
+			c = cfg.heatmapColor(cfg.barPosition(frac))
+		}
+		fillRect(out, margin+x, y, 1, barHeight, c)
+	}
+	if cfg.ColorMode != phaseColorMode {
+		// The tone mapping curve, from the bottom to the top of the bar.
+		for x := 0; x < barWidth; x++ {
+			val := cfg.barPosition(float64(x) / float64(barWidth-1))
+			cy := y + barHeight - scale - int(math.Round(val*float64(barHeight-scale)))
+			fillRect(out, margin+x, cy, scale, scale, color.White)
+		}
+	}
+	y += barHeight + scale
+	left, right := "-pi", "pi"
+	switch cfg.ColorMode {
+	case densityColorMode:
+		left = fmt.Sprintf("%.3g %v", top*cfg.barDensity(0), cfg.unit("-3"))
+		right = fmt.Sprintf("%.3g %v", top, cfg.unit("-3"))
+	case signedColorMode:
+		left = fmt.Sprintf("%.3g %v", -top, cfg.unit("-3/2"))
+		right = fmt.Sprintf("%.3g %v", top, cfg.unit("-3/2"))
+	}
+	drawText(out, margin, y, scale, left, color.White)
+	drawText(out, w-margin-textWidth(right, scale), y, scale, right, color.White)
+	y += lineHeight
+
+	for _, label := range labels {
+		drawText(out, margin, y, scale, label, color.White)
+		y += lineHeight
+	}
+
+	// The scale bar is the longest 1, 2 or 5 times a power of 10 bohr radii, or hbar/a_0 in momentum space, within a
+	// quarter of the view.
+	view := cfg.viewSize()
+	length := math.Pow(10, math.Floor(math.Log10(view/4)))
+	for _, mult := range []float64{5, 2} {
+		if mult*length <= view/4 {
+			length *= mult
+			break
+		}
+	}
+	barPixels := int(math.Round(length / view * float64(cfg.ImageSize-1)))
+	fillRect(out, margin, y+(glyphHeight-2)*scale/2, barPixels, 2*scale, color.White)
+	drawText(out, margin+barPixels+2*scale, y, scale, fmt.Sprintf("%g %v", length, cfg.unit("")), color.White)
+	return out
+}
+
+// Returns the position on the heatmap at position frac in [0,1] along the colorbar, which spans the normalized density,
+// or the normalized Re psi from -1 to 1 for signed coloring.
+func (cfg *Config) barPosition(frac float64) float64 {
+	if cfg.ColorMode == signedColorMode {
+		s := 2*frac - 1
+		if s < 0 {
+			return cfg.signedToneMap(-cfg.barDensity(-s))
+		}
+		return cfg.signedToneMap(cfg.barDensity(s))
+	}
+	return cfg.toneMap(cfg.barDensity(frac))
+}
+
+// Returns the normalized density at position frac in [0,1] along the colorbar, logarithmic for the log scale.
+func (cfg *Config) barDensity(frac float64) float64 {
+	if cfg.Scale == logScale {
+		return math.Pow(10, (frac-1)*cfg.LogDecades)
+	}
+	return frac
+}
+
+// Returns the quantum numbers of the state, or the terms of the superposition, followed by the nuclear charge and the
+// reduced mass unless they are those of hydrogen.
+func stateLabel(cfg *Config) string {
+	var label string
+	if len(cfg.Terms) == 1 {
+		t := cfg.Terms[0]
+		label = fmt.Sprintf("n=%v l=%v m=%v %v", t.N, t.L, t.M, cfg.Orbitals)
+	} else {
+		var terms []string
+		for _, t := range cfg.Terms {
+			terms = append(terms, fmt.Sprintf("(%v,%v,%v)", t.N, t.L, t.M))
+		}
+		label = fmt.Sprintf("%v %v", strings.Join(terms, "+"), cfg.Orbitals)
+	}
+	if cfg.Z != 1 {
+		label += fmt.Sprintf(" Z=%v", cfg.Z)
+	}
+	if cfg.ReducedMass != 1 {
+		label += fmt.Sprintf(" mu=%.6g", cfg.ReducedMass)
+	}
+	return label
+}
@@ -0,0 +1,121 @@
+package hydrogen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// Probability enclosed by the sphere spanned by auto fovSize.
+	autoEnclosed = 0.999
+	// Layers per node spacing for auto layerDist.
+	autoLayersPerNode = 4
+	// Grid points per node when locating the nodes by their sign changes.
+	autoNodeSamples = 16
+)
+
+// AutoLength is a length of the config that may be given as "auto" to derive it from the state, see resolveAuto().
+type AutoLength struct {
+	Value float64
+	// If set, Value is derived from the state before rendering.
+	Auto bool
+}
+
+func (a AutoLength) MarshalJSON() ([]byte, error) {
+	if a.Auto {
+		return []byte(`"auto"`), nil
+	}
+	return json.Marshal(a.Value)
+}
+
+func (a *AutoLength) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "auto" {
+			return fmt.Errorf("invalid length %q, must be a number or \"auto\"", s)
+		}
+		a.Auto = true
+		return nil
+	}
+	return json.Unmarshal(data, &a.Value)
+}
+
+// Derives the auto fovSize and layerDist from the radial distribution and the nodes of the terms once. The field of
+// view is the diameter of the largest sphere enclosing autoEnclosed of the probability of any term. The layers are
+// spaced so that the narrowest of the typical node spacings of the terms spans autoLayersPerNode layers, where the
+// radial node spacing is the median gap between the radial nodes of the term within its sphere, and the angular one the
+// median angle between the nodes of P_l^|m| (and for the real orbitals the nodal planes of cos(m phi) or sin(|m| phi))
+// times the mean radius.
+func (cfg *Config) resolveAuto() error {
+	if !cfg.FOVSize.Auto && !cfg.LayerDist.Auto {
+		return nil
+	}
+	eval := newEvaluator(cfg)
+	scale, _ := eval.scale.Float64()
+	radius, spacing := 0.0, math.Inf(1)
+	for _, t := range eval.terms {
+		r := newRadialSampler(eval.prec, t).invert(1 - autoEnclosed)
+		radius = math.Max(radius, r)
+
+		radial := signChanges(func(x float64) int {
+			return t.radPoly.eval(newFromFloat64(eval.prec, x)).Sign()
+		}, 0, r, autoNodeSamples*t.n)
+		spacing = math.Min(spacing, medianGap(0, radial, r))
+		angular := signChanges(func(x float64) int {
+			return t.angularPoly.eval(newFromFloat64(eval.prec, math.Cos(x))).Sign()
+		}, 0, math.Pi, autoNodeSamples*(t.l+1))
+		// The mean radius <r>=(3n^2-l(l+1))/2 in units of the Bohr radius of the ion.
+		mean := float64(3*t.n*t.n-t.l*(t.l+1)) / 2
+		spacing = math.Min(spacing, mean*medianGap(0, angular, math.Pi))
+		if t.real && t.m != 0 {
+			spacing = math.Min(spacing, mean*math.Pi/math.Abs(float64(t.m)))
+		}
+	}
+	if cfg.FOVSize.Auto {
+		cfg.FOVSize = AutoLength{Value: 2 * radius / scale}
+		cfg.logf("auto fovSize %.4g %v, enclosing %v%% of the probability\n",
+			cfg.FOVSize.Value, cfg.unit(""), 100*autoEnclosed)
+	}
+	if cfg.LayerDist.Auto {
+		cfg.LayerDist = AutoLength{Value: spacing / autoLayersPerNode / scale}
+		cfg.logf("auto layerDist %.4g %v, the %v layers span %.4g %v\n",
+			cfg.LayerDist.Value, cfg.unit(""), cfg.Layers, float64(cfg.Layers-1)*cfg.LayerDist.Value, cfg.unit(""))
+		if cfg.Projection == perspectiveProjection {
+			return cfg.checkCameraDistance()
+		}
+	}
+	return nil
+}
+
+// Returns the midpoints of the cells of the grid of the given number of steps over (lo,hi) where the sign of f changes,
+// skipping the zeros of f on the grid.
+func signChanges(f func(x float64) int, lo, hi float64, steps int) []float64 {
+	var nodes []float64
+	step := (hi - lo) / float64(steps)
+	prev, prevX := 0, lo
+	for k := 1; k < steps; k++ {
+		x := lo + float64(k)*step
+		s := f(x)
+		if s == 0 {
+			continue
+		}
+		if prev != 0 && s != prev {
+			nodes = append(nodes, (prevX+x)/2)
+		}
+		prev, prevX = s, x
+	}
+	return nodes
+}
+
+// Returns the median of the gaps between lo, the nodes in increasing order and hi.
+func medianGap(lo float64, nodes []float64, hi float64) float64 {
+	bounds := append(append([]float64{lo}, nodes...), hi)
+	gaps := make([]float64, len(bounds)-1)
+	for k := range gaps {
+		gaps[k] = bounds[k+1] - bounds[k]
+	}
+	sort.Float64s(gaps)
+	return gaps[(len(gaps)-1)/2]
+}
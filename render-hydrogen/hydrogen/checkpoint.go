@@ -0,0 +1,272 @@
+package hydrogen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+)
+
+// Magic bytes at the beginning of the checkpoint file, followed by the config fingerprint and then the column records.
+var checkpointMagic = []byte("RHCK")
+
+// One completed pixel column i of the render, for all frames.
+type column struct {
+	i int
+	// Indexed by j.
+	pixels []*pixelResult
+}
+
+// Returns the number of pixels in this column that were escalated to big.Float.
+func (col *column) escalated() int {
+	cnt := 0
+	for _, px := range col.pixels {
+		if px.escalated {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Append-only checkpoint file holding completed columns. Each column is written as a length-prefixed record, so a
+// record truncated by a crash is simply discarded on resume.
+type checkpoint struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+	// Columns loaded from a previous run, keyed by i.
+	loaded map[int]*column
+	// First failure to write the file, after which nothing more is written.
+	err error
+}
+
+// Opens the checkpoint file for the config, loading the completed columns if resume is set, or starting a new one
+// otherwise, refusing to replace an existing file.
+func openCheckpoint(cfg *Config, frames int, resume bool) (*checkpoint, error) {
+	ckpt := &checkpoint{loaded: make(map[int]*column)}
+	if !resume {
+		if _, err := os.Stat(cfg.CheckpointFile); err == nil {
+			return nil, fmt.Errorf("checkpoint file %v exists, rerun with -resume or remove it", cfg.CheckpointFile)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to stat checkpoint file: %w", err)
+		}
+	} else {
+		if data, err := os.ReadFile(cfg.CheckpointFile); err == nil {
+			if err := ckpt.load(cfg, frames, data); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+		}
+	}
+
+	// Rewrite the loaded columns into a new file, which also drops any truncated record at the end. The old file is
+	// only replaced once the new one is complete.
+	tmp := cfg.CheckpointFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	ckpt.f = f
+	ckpt.w = bufio.NewWriter(f)
+	ckpt.w.Write(checkpointMagic)
+	ckpt.w.Write(cfg.fingerprint[:])
+	for _, col := range ckpt.loaded {
+		ckpt.write(col)
+	}
+	if err := ckpt.flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, cfg.CheckpointFile); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to rename checkpoint file: %w", err)
+	}
+	return ckpt, nil
+}
+
+func (ckpt *checkpoint) load(cfg *Config, frames int, data []byte) error {
+	header := len(checkpointMagic) + len(cfg.fingerprint)
+	if len(data) < header || !bytes.Equal(data[:len(checkpointMagic)], checkpointMagic) {
+		return fmt.Errorf("invalid checkpoint file: %v", cfg.CheckpointFile)
+	}
+	if !bytes.Equal(data[len(checkpointMagic):header], cfg.fingerprint[:]) {
+		return fmt.Errorf("checkpoint file %v was written with a different config", cfg.CheckpointFile)
+	}
+	r := bytes.NewReader(data[header:])
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			break
+		}
+		// A record longer than the rest of the file was truncated by a crash.
+		if int64(size) > int64(r.Len()) {
+			break
+		}
+		rec := make([]byte, size)
+		io.ReadFull(r, rec)
+		col, err := decodeColumn(cfg, frames, rec)
+		if err != nil {
+			return fmt.Errorf("corrupted checkpoint file %v: %w", cfg.CheckpointFile, err)
+		}
+		if ckpt.loaded[col.i] != nil {
+			return fmt.Errorf("corrupted checkpoint file %v: duplicate column %v", cfg.CheckpointFile, col.i)
+		}
+		ckpt.loaded[col.i] = col
+	}
+	cfg.logf("resumed %v of %v columns from %v\n", len(ckpt.loaded), cfg.ImageSize, cfg.CheckpointFile)
+	return nil
+}
+
+// Appends the completed column, safe for concurrent use. Returns the first failure to write the file, if any.
+func (ckpt *checkpoint) write(col *column) error {
+	var buf bytes.Buffer
+	putUint32(&buf, col.i)
+	for _, px := range col.pixels {
+		if px.escalated {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		for f := range px.data {
+			putFloat(&buf, px.data[f])
+			if px.amps != nil {
+				putFloat(&buf, px.amps[f].re)
+				putFloat(&buf, px.amps[f].im)
+			}
+			if px.layers != nil {
+				binary.Write(&buf, binary.LittleEndian, px.layers[f])
+			}
+		}
+	}
+	ckpt.mu.Lock()
+	defer ckpt.mu.Unlock()
+	if ckpt.err == nil {
+		binary.Write(ckpt.w, binary.LittleEndian, uint32(buf.Len()))
+		if _, err := ckpt.w.Write(buf.Bytes()); err != nil {
+			ckpt.err = fmt.Errorf("failed to write checkpoint file: %w", err)
+		}
+	}
+	return ckpt.err
+}
+
+// Writes all buffered columns to the file. Returns the first failure to write the file, if any.
+func (ckpt *checkpoint) flush() error {
+	ckpt.mu.Lock()
+	defer ckpt.mu.Unlock()
+	if ckpt.err != nil {
+		return ckpt.err
+	}
+	if err := ckpt.w.Flush(); err != nil {
+		ckpt.err = fmt.Errorf("failed to write checkpoint file: %w", err)
+	} else if err := ckpt.f.Sync(); err != nil {
+		ckpt.err = fmt.Errorf("failed to sync checkpoint file: %w", err)
+	}
+	return ckpt.err
+}
+
+// Returns the first failure to write the file, if any.
+func (ckpt *checkpoint) failed() error {
+	ckpt.mu.Lock()
+	defer ckpt.mu.Unlock()
+	return ckpt.err
+}
+
+func (ckpt *checkpoint) close() error {
+	err := ckpt.flush()
+	ckpt.f.Close()
+	return err
+}
+
+func decodeColumn(cfg *Config, frames int, rec []byte) (*column, error) {
+	r := bytes.NewReader(rec)
+	i, err := getUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if i >= cfg.ImageSize {
+		return nil, fmt.Errorf("column %v out of range", i)
+	}
+	col := &column{i: i, pixels: make([]*pixelResult, cfg.ImageSize)}
+	for j := range col.pixels {
+		esc, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		px := &pixelResult{data: make([]*big.Float, frames), escalated: esc != 0}
+		if cfg.keepAmps() {
+			px.amps = make([]complexFloat, frames)
+		}
+		if cfg.keepLayers() {
+			px.layers = make([][]float64, frames)
+		}
+		for f := 0; f < frames; f++ {
+			if px.data[f], err = getFloat(r); err != nil {
+				return nil, err
+			}
+			if px.amps != nil {
+				re, err := getFloat(r)
+				if err != nil {
+					return nil, err
+				}
+				im, err := getFloat(r)
+				if err != nil {
+					return nil, err
+				}
+				px.amps[f] = complexFloat{re: re, im: im}
+			}
+			if px.layers != nil {
+				px.layers[f] = make([]float64, cfg.Layers)
+				if err := binary.Read(r, binary.LittleEndian, px.layers[f]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		col.pixels[j] = px
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%v unexpected bytes after column %v", r.Len(), i)
+	}
+	return col, nil
+}
+
+func putUint32(buf *bytes.Buffer, v int) {
+	binary.Write(buf, binary.LittleEndian, uint32(v))
+}
+
+func getUint32(r *bytes.Reader) (int, error) {
+	var v uint32
+	err := binary.Read(r, binary.LittleEndian, &v)
+	return int(v), err
+}
+
+// Writes the exact binary representation of the big.Float, so that the resumed render is bit-identical.
+func putFloat(buf *bytes.Buffer, x *big.Float) {
+	// Encoding a big.Float never fails.
+	b, _ := x.GobEncode()
+	putUint32(buf, len(b))
+	buf.Write(b)
+}
+
+func getFloat(r *bytes.Reader) (*big.Float, error) {
+	size, err := getUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, size)
+	io.ReadFull(r, b)
+	// Zero precision so that the decoded value is exact.
+	x := new(big.Float)
+	if err := x.GobDecode(b); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
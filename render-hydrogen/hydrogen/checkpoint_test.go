@@ -0,0 +1,136 @@
+package hydrogen
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Renders the config with a fresh checkpoint, and returns the frames.
+func renderWithCheckpoint(t *testing.T, cfg *Config) []*frame {
+	t.Helper()
+	rd, err := newRenderer(cfg, []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ckpt, err := openCheckpoint(cfg, rd.frameCount(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, _, err := rd.render(context.Background(), ckpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ckpt.close(); err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	cfg := testConfig(t, map[string]interface{}{
+		"checkpointFile": filepath.Join(t.TempDir(), "ckpt"),
+		"colorMode":      "phase",
+		"rawOutput": map[string]interface{}{
+			"file": filepath.Join(t.TempDir(), "raw"), "formats": []string{"npy"}, "layers": true,
+		},
+	})
+	frames := renderWithCheckpoint(t, cfg)
+
+	ckpt, err := openCheckpoint(cfg, len(frames), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ckpt.close()
+	if len(ckpt.loaded) != cfg.ImageSize {
+		t.Fatalf("loaded %v columns, want %v", len(ckpt.loaded), cfg.ImageSize)
+	}
+	size := cfg.ImageSize
+	for i, col := range ckpt.loaded {
+		for j, px := range col.pixels {
+			p := j*size + i
+			fr := frames[0]
+			// The values are stored exactly, so that a resumed render is bit-identical.
+			if px.data[0].Cmp(fr.data[p]) != 0 || px.amps[0].re.Cmp(fr.amps[p].re) != 0 ||
+				px.amps[0].im.Cmp(fr.amps[p].im) != 0 {
+				t.Fatalf("pixel (%v,%v) differs after loading", i, j)
+			}
+			for k, d := range px.layers[0] {
+				if d != fr.layers[k*size*size+p] {
+					t.Fatalf("layer %v of pixel (%v,%v) differs after loading", k, i, j)
+				}
+			}
+		}
+	}
+}
+
+// Without resume, an existing checkpoint is neither loaded nor replaced.
+func TestCheckpointExists(t *testing.T) {
+	cfg := testConfig(t, map[string]interface{}{"checkpointFile": filepath.Join(t.TempDir(), "ckpt")})
+	frames := renderWithCheckpoint(t, cfg)
+	want, err := os.ReadFile(cfg.CheckpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCheckpoint(cfg, len(frames), false); err == nil || !strings.Contains(err.Error(), "-resume") {
+		t.Errorf("error %v, expecting the existing checkpoint to be refused", err)
+	}
+	if data, err := os.ReadFile(cfg.CheckpointFile); err != nil || !bytes.Equal(data, want) {
+		t.Errorf("checkpoint file changed, error %v", err)
+	}
+}
+
+func TestCheckpointCorrupt(t *testing.T) {
+	cfg := testConfig(t, map[string]interface{}{"checkpointFile": filepath.Join(t.TempDir(), "ckpt")})
+	renderWithCheckpoint(t, cfg)
+	data, err := os.ReadFile(cfg.CheckpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := len(checkpointMagic) + len(cfg.fingerprint)
+	firstLen := int(binary.LittleEndian.Uint32(data[header:]))
+	first := data[header : header+4+firstLen]
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		loaded int
+		err    string
+	}{
+		{"truncated", data[:len(data)-3], cfg.ImageSize - 1, ""},
+		{"huge record", append(append([]byte{}, data...), 0xff, 0xff, 0xff, 0xff, 1, 2, 3), cfg.ImageSize, ""},
+		{"duplicate", append(append([]byte{}, data...), first...), 0, "duplicate column"},
+		{"out of range", func() []byte {
+			b := append([]byte{}, data...)
+			binary.LittleEndian.PutUint32(b[header+4:], uint32(cfg.ImageSize))
+			return b
+		}(), 0, "out of range"},
+		{"trailing bytes", func() []byte {
+			b := append([]byte{}, data[:header]...)
+			b = binary.LittleEndian.AppendUint32(b, uint32(firstLen+1))
+			b = append(b, first[4:]...)
+			return append(b, 0)
+		}(), 0, "unexpected bytes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ckpt := &checkpoint{loaded: make(map[int]*column)}
+			err := ckpt.load(cfg, 1, tc.data)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ckpt.loaded) != tc.loaded {
+				t.Fatalf("loaded %v columns, want %v", len(ckpt.loaded), tc.loaded)
+			}
+		})
+	}
+}
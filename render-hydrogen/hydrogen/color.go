@@ -0,0 +1,32 @@
+package hydrogen
+
+import (
+	"image/color"
+	"math"
+)
+
+// Maps the phase (in radians) to hue and val in [0,1] to brightness, with full saturation.
+func phaseColor(phase, val float64) color.RGBA64 {
+	h := phase / (2 * math.Pi)
+	h -= math.Floor(h)
+	h *= 6
+	sector := int(h)
+	f := h - float64(sector)
+	p, q, t := 0.0, val*(1-f), val*f
+	var r, g, b float64
+	switch sector % 6 {
+	case 0:
+		r, g, b = val, t, p
+	case 1:
+		r, g, b = q, val, p
+	case 2:
+		r, g, b = p, val, t
+	case 3:
+		r, g, b = p, q, val
+	case 4:
+		r, g, b = t, p, val
+	default:
+		r, g, b = val, p, q
+	}
+	return color.RGBA64{R: uint16(r * 0xffff), G: uint16(g * 0xffff), B: uint16(b * 0xffff), A: 0xffff}
+}
@@ -0,0 +1,81 @@
+package hydrogen
+
+import (
+	"math"
+	"math/big"
+)
+
+// Complex number with big.Float real and imaginary parts. Results take the precision of the operands.
+type complexFloat struct {
+	re, im *big.Float
+}
+
+func blankComplex(prec uint) complexFloat {
+	return complexFloat{re: blankFloat(prec), im: blankFloat(prec)}
+}
+
+func newComplex(re, im *big.Float) complexFloat {
+	return complexFloat{re: new(big.Float).Set(re), im: new(big.Float).Set(im)}
+}
+
+// Sets z to a+b and returns z.
+func (z complexFloat) add(a, b complexFloat) complexFloat {
+	z.re.Add(a.re, b.re)
+	z.im.Add(a.im, b.im)
+	return z
+}
+
+// Sets z to a*b and returns z, a and b may alias z.
+func (z complexFloat) mul(a, b complexFloat) complexFloat {
+	re := new(big.Float).Mul(a.re, b.re)
+	re.Sub(re, new(big.Float).Mul(a.im, b.im))
+	im := new(big.Float).Mul(a.re, b.im)
+	im.Add(im, new(big.Float).Mul(a.im, b.re))
+	z.re.Set(re)
+	z.im.Set(im)
+	return z
+}
+
+// Sets z to a*s for real s and returns z.
+func (z complexFloat) scale(a complexFloat, s *big.Float) complexFloat {
+	z.re.Mul(a.re, s)
+	z.im.Mul(a.im, s)
+	return z
+}
+
+// Returns |z|^2.
+func (z complexFloat) abs2() *big.Float {
+	ans := new(big.Float).Mul(z.re, z.re)
+	return ans.Add(ans, new(big.Float).Mul(z.im, z.im))
+}
+
+// Returns z^n for non-negative n, computed in logarithmic time.
+func (z complexFloat) pow(n int) complexFloat {
+	ans := newComplex(newFromFloat64(z.re.Prec(), 1.0), blankFloat(z.re.Prec()))
+	base := newComplex(z.re, z.im)
+	for n != 0 {
+		if n&1 == 1 {
+			ans.mul(ans, base)
+		}
+		n = n >> 1
+		if n != 0 {
+			base.mul(base, base)
+		}
+	}
+	return ans
+}
+
+// Returns arg(z) in (-pi, pi].
+func (z complexFloat) arg() float64 {
+	// Scale both parts by the larger magnitude so that the conversion to float64 does not underflow.
+	s := new(big.Float).Abs(z.re)
+	if s.Cmp(new(big.Float).Abs(z.im)) < 0 {
+		s.Abs(z.im)
+	}
+	if s.Sign() == 0 {
+		return 0
+	}
+	re, _ := new(big.Float).Quo(z.re, s).Float64()
+	im, _ := new(big.Float).Quo(z.im, s).Float64()
+	return math.Atan2(im, re)
+}
@@ -0,0 +1,932 @@
+package hydrogen
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Configures the hydrogen renderer.
+type Config struct {
+	// Theta angle of the camera, in degrees.
+	CameraTheta float64 `json:"cameraTheta"`
+	// Phi angle of the camera, in degrees,
+	CameraPhi float64 `json:"cameraPhi"`
+	// Image size in pixels.
+	ImageSize int `json:"imageSize"`
+	// Roll angle of the camera around the view direction, in degrees, counterclockwise as seen by the camera.
+	CameraRoll float64 `json:"cameraRoll"`
+	// Point the camera looks at, in units of bohr radius, defaults to the origin. The middle layer contains it.
+	LookAt [3]float64 `json:"lookAt"`
+	// Either "orthographic" (default) or "perspective".
+	Projection string `json:"projection"`
+	// Field-of-view size in units of bohr radius, for orthographic projection, or "auto" for the diameter of the
+	// sphere enclosing 99.9% of the probability.
+	FOVSize AutoLength `json:"fovSize"`
+	// Distance from the camera to lookAt in units of bohr radius, and full field-of-view angle in degrees, for
+	// perspective projection.
+	CameraDistance float64 `json:"cameraDistance"`
+	FOVAngle       float64 `json:"fovAngle"`
+	// Distance between sampling layers, or "auto" for a quarter of the spacing of the radial and angular nodes.
+	LayerDist AutoLength `json:"layerDist"`
+	// Sampling layers to compute, must be positive odd number, the middle of which represents the perpendicular plane of sight containing origin.
+	Layers int `json:"layers"`
+	// How the layers along each ray are combined into the pixel: "sum" (default) adds up the density of all layers,
+	// "emission" composites them front to back with emission and absorption, "mip" takes the maximum density, and
+	// "slice" shows the single layer sliceLayer.
+	Compositing string `json:"compositing"`
+	// Samples per pixel along each axis, on a jittered grid against aliasing, defaults to 1 for a single sample at the
+	// pixel center.
+	Supersampling int `json:"supersampling"`
+	// If positive, all pixels are first rendered with a single sample, and only the pixels whose position on the
+	// heatmap differs by more than this from a neighbor in any frame are rendered again with supersampling.
+	AdaptiveThreshold float64 `json:"adaptiveThreshold"`
+	// Opacity transfer function for emission compositing, as [density, opacity] control points with increasing
+	// density, linearly interpolated. The density is relative to the max sampled density, and the opacity is per
+	// layer. Defaults to [[0, 0], [1, 0.3]].
+	Opacity [][2]float64 `json:"opacity"`
+	// Layer shown by slice compositing, counted from the middle layer towards the back, defaults to 0.
+	SliceLayer int `json:"sliceLayer"`
+
+	Concurrency int `json:"concurrency"`
+	// Precision in binary digits for the float.
+	FloatPrec uint `json:"floatPrec"`
+	// Either "auto" (default) to evaluate in float64 and fall back to big.Float only where float64 loses precision,
+	// or "big" to always evaluate in big.Float.
+	Evaluation string `json:"evaluation"`
+
+	// Exactly one of the heatmap sources: a .PNG file whose first row is the heatmap, the name of a built-in heatmap
+	// ("viridis", "magma", "inferno", "cividis", or the diverging "coolwarm" for signed coloring), or a custom
+	// gradient.
+	HeatmapFile string         `json:"heatmapFile"`
+	Heatmap     string         `json:"heatmap"`
+	Gradient    []GradientStop `json:"gradient"`
+	// Whether to reverse the heatmap.
+	ReverseHeatmap bool    `json:"reverseHeatmap"`
+	OutputFile     string  `json:"outputFile"`
+	Exposure       float32 `json:"exposure"`
+	// Either "max" (default) to map the max density of the render to the top of the heatmap, or "absolute" to map the
+	// physical probability density absoluteMax in units of a_0^-3 there, so that renders are comparable. With sum
+	// compositing, the density of a pixel is the mean over the layers.
+	Normalization string  `json:"normalization"`
+	AbsoluteMax   float64 `json:"absoluteMax"`
+	// Either "linear" (default) or "log" intensity scale, the latter covering logDecades decades (default 6) below the
+	// max.
+	Scale      string  `json:"scale"`
+	LogDecades float64 `json:"logDecades"`
+	// Scaled intensities below clipLow (default 0) or above clipHigh (default 1) are clipped, and the range in between
+	// is stretched over the whole heatmap.
+	ClipLow  float64 `json:"clipLow"`
+	ClipHigh float64 `json:"clipHigh"`
+	// Whether to append the annotation panel with the colorbar, the state, the camera and a scale bar to the images.
+	Annotate bool `json:"annotate"`
+	// Either "density" (default) for the heatmap of |psi|^2, "phase" where the hue encodes arg(psi) and the
+	// brightness encodes |psi|^2, or "signed" for the heatmap of Re psi scaled to [-max, max], with zero in the middle.
+	ColorMode string `json:"colorMode"`
+	// Either "position" (default) to render psi(r), or "momentum" to render its Fourier transform phi(p), in which case
+	// all lengths of the config, e.g., fovSize, layerDist and lookAt, are momenta in units of hbar/a_0.
+	Space string `json:"space"`
+	// Nuclear charge, defaults to 1 for hydrogen, e.g., 2 for He+.
+	Z int `json:"z"`
+	// Reduced mass of the electron and the nucleus in units of the electron mass, defaults to 1 for an infinitely
+	// heavy nucleus, e.g., 0.5 for positronium. Distances remain in units of a_0 and times in hbar/E_h, and the Bohr
+	// radius and the energies of the ion scale as 1/(Z mu) and Z^2 mu.
+	ReducedMass float64 `json:"reducedMass"`
+	// Quantum numbers, used when terms is empty.
+	N int `json:"n"`
+	L int `json:"l"`
+	M int `json:"m"`
+	// Terms of the superposition state, the amplitudes will be normalized so that the state has unit norm.
+	Terms []Term `json:"terms"`
+	// If set, renders the time evolution of the state as a sequence of frames.
+	Animation *Animation `json:"animation"`
+	// If set, renders the camera turning around the z axis as a sequence of frames, cannot be combined with animation.
+	Turntable *Turntable `json:"turntable"`
+	// If set, renders a stereo pair for each frame.
+	Stereo *Stereo `json:"stereo"`
+	// If set, renders the panels side by side in one image, panelColumns (default all) per row, each normalized on its
+	// own or, with panelNormalization "shared", all on the same scale of the physical density.
+	Panels             []Panel `json:"panels"`
+	PanelColumns       int     `json:"panelColumns"`
+	PanelNormalization string  `json:"panelNormalization"`
+	// Angular basis of the terms, either "complex" (default) for Y_l^m, or "real" for the real (tesseral) orbitals
+	// proportional to Y_l^m±Y_l^{-m}, i.e., carrying cos(m phi) for m>0 and sin(|m| phi) for m<0.
+	Orbitals string `json:"orbitals"`
+
+	// Periodically persists the completed columns to this file if set, so that the render can be resumed.
+	CheckpointFile string `json:"checkpointFile"`
+	// Seconds between checkpoint writes, defaults to 60.
+	CheckpointInterval int `json:"checkpointInterval"`
+
+	// If set, also writes the raw density data.
+	RawOutput *RawOutput `json:"rawOutput"`
+	// If set, renders a batch of states or configs derived from this one, see sweep.
+	Sweep *Sweep `json:"sweep"`
+	// Isosurface mesh written by the -mesh flag.
+	Isosurface *Isosurface `json:"isosurface"`
+	// Point cloud written by the -points flag.
+	PointCloud *PointCloud `json:"pointCloud"`
+	// If set, a downscaled preview is rendered in float64 and written before the full render, or instead of it with the
+	// -preview flag.
+	Preview *Preview `json:"preview"`
+	// Side length in pixels of the tiles farmed out to workers in distributed rendering, defaults to 64.
+	TileSize int `json:"tileSize"`
+	// Seconds a worker may take to render a tile before the tile is handed to another worker, defaults to 3600.
+	TileTimeout int `json:"tileTimeout"`
+	// If set, progress and statistics are written to it, e.g., os.Stdout, otherwise the renderer is silent.
+	Log io.Writer `json:"-"`
+
+	heatmap []color.Color
+	// Cutting plane of the panel this config is derived for, nil for the camera's view.
+	plane *Panel
+	// JSON encoding of the config before validation, the jobs of a sweep are derived from it.
+	source []byte
+	// Hash of source, a checkpoint can only be resumed, and a coordinator only served, with the identical config.
+	fingerprint [sha256.Size]byte
+	// Whether to leave out the progress bars, e.g., for the jobs of a sweep, which share the bar of the sweep.
+	quiet bool
+}
+
+// A single (n,l,m) term of the superposition state with complex amplitude.
+type Term struct {
+	N int `json:"n"`
+	L int `json:"l"`
+	M int `json:"m"`
+	// Real and imaginary part of the amplitude.
+	Re float64 `json:"re"`
+	Im float64 `json:"im"`
+}
+
+// Configures the time-evolution animation.
+type Animation struct {
+	// Time of the first and last frame, in atomic units of time hbar/E_h.
+	StartTime float64 `json:"startTime"`
+	EndTime   float64 `json:"endTime"`
+	// Number of frames, the frames are numbered PNG files named after outputFile.
+	Frames int `json:"frames"`
+	// Animated GIF file of all frames.
+	GIFFile string `json:"gifFile"`
+	// Delay between frames in the GIF, in 100ths of a second.
+	FrameDelay int `json:"frameDelay"`
+}
+
+// Configures the turntable sequence.
+type Turntable struct {
+	// Number of frames over the full turn, i.e., cameraPhi advances by 360/frames degrees per frame. The frames are
+	// numbered PNG files named after outputFile.
+	Frames int `json:"frames"`
+	// Animated GIF file of all frames.
+	GIFFile string `json:"gifFile"`
+	// Delay between frames in the GIF, in 100ths of a second.
+	FrameDelay int `json:"frameDelay"`
+}
+
+// Configures the stereo pair.
+type Stereo struct {
+	// Either "anaglyph" for red-cyan glasses, or "sideBySide" for the left eye's image on the left of the right eye's.
+	Mode string `json:"mode"`
+	// Angle in degrees between the views of the two eyes, which turn around lookAt, defaults to 4.
+	Separation float64 `json:"separation"`
+}
+
+// Configures the batch sweep. The jobs are all (n,l,m) states with n in the given list, optionally restricted to the l
+// and m in the given lists, followed by this config with each of the overrides applied. All jobs are rendered by one
+// pool of concurrency workers.
+type Sweep struct {
+	N []int `json:"n"`
+	L []int `json:"l"`
+	M []int `json:"m"`
+	// Partial configs whose fields replace those of this config.
+	Overrides []map[string]json.RawMessage `json:"overrides"`
+	// HTML contact sheet of the outputs of all jobs.
+	IndexFile string `json:"indexFile"`
+}
+
+// Configures a panel of the multi-panel layout.
+type Panel struct {
+	// Normal of the cutting plane, shown face-on from the side the normal points to, e.g., [0, 0, 1] for the xy plane.
+	// If unset, the panel shows the camera's view of the layers.
+	Normal *[3]float64 `json:"normal"`
+	// Signed distance of the plane from the origin along the normal, in units of bohr radius. The plane is centered at
+	// the projection of lookAt.
+	Offset float64 `json:"offset"`
+}
+
+// Configures the raw density output.
+type RawOutput struct {
+	// Path of the raw files without extension, e.g., "./outputs/5-3-0" writes "./outputs/5-3-0.npy" for the summed
+	// density and "./outputs/5-3-0-layers.npy" for the layers. Frames of animations are numbered like the PNG files.
+	File string `json:"file"`
+	// Any of "npy", "csv" and "vtk".
+	Formats []string `json:"formats"`
+	// Whether to also write the density of each layer, as a volume.
+	Layers bool `json:"layers"`
+}
+
+// Configures the isosurface mesh export.
+type Isosurface struct {
+	// The wavefunction is sampled on the cube [-extent,extent]^3 in units of bohr radius.
+	Extent float64 `json:"extent"`
+	// Number of grid points along each axis.
+	Resolution int `json:"resolution"`
+	// Fraction of the probability enclosed by the surface, e.g., 0.9.
+	Enclosed float64 `json:"enclosed"`
+	// Path of the mesh files without extension.
+	File string `json:"file"`
+	// Any of "obj", "ply" and "stl".
+	Formats []string `json:"formats"`
+}
+
+// Configures the point cloud sampling.
+type PointCloud struct {
+	// Number of points sampled from |psi|^2.
+	Points int `json:"points"`
+	// Path of the point files without extension, the points as seen by the camera are also written to the .png file.
+	File string `json:"file"`
+	// Any of "csv" and "ply".
+	Formats []string `json:"formats"`
+}
+
+// Configures the preview.
+type Preview struct {
+	// Image size in pixels, defaults to 200, or imageSize if smaller.
+	ImageSize int `json:"imageSize"`
+	// PNG file of the preview, defaults to outputFile suffixed with -preview, e.g., outputs/5-3-1-preview.png.
+	File string `json:"file"`
+}
+
+// Whether the composited amplitudes need to be kept for the color mode.
+func (cfg *Config) keepAmps() bool {
+	return cfg.ColorMode != densityColorMode
+}
+
+// Whether the density of each layer needs to be kept.
+func (cfg *Config) keepLayers() bool {
+	return cfg.RawOutput != nil && cfg.RawOutput.Layers
+}
+
+// Returns the size in units of bohr radius of the field of view in the middle layer.
+func (cfg *Config) viewSize() float64 {
+	if cfg.Projection == perspectiveProjection {
+		return 2 * cfg.CameraDistance * math.Tan(cfg.FOVAngle/2)
+	}
+	return cfg.FOVSize.Value
+}
+
+// Returns the value of the composited data that maps to the top of the heatmap, given the max of the data.
+func (cfg *Config) normalizationScale(max *big.Float) *big.Float {
+	if cfg.Normalization == maxNormalization {
+		return max
+	}
+	return cfg.compositedData(cfg.AbsoluteMax)
+}
+
+// Returns the composited data of a pixel with the given probability density in a_0^-3, the inverse of
+// physicalDensity.
+func (cfg *Config) compositedData(density float64) *big.Float {
+	data := newFromFloat64(cfg.FloatPrec, density)
+	if cfg.Compositing == sumCompositing {
+		data.Mul(data, newFromInt(cfg.FloatPrec, cfg.Layers))
+	}
+	return data
+}
+
+// Returns the unit of length, or of momentum in momentum space, raised to the given power for the labels, e.g.,
+// "a0^-3".
+func (cfg *Config) unit(power string) string {
+	if cfg.Space == momentumSpace {
+		if power == "" {
+			return "hbar/a0"
+		}
+		return "(hbar/a0)^" + power
+	}
+	if power == "" {
+		return "a0"
+	}
+	return "a0^" + power
+}
+
+// Returns the probability density in a_0^-3 of a pixel with the given composited data.
+func (cfg *Config) physicalDensity(data *big.Float) float64 {
+	density, _ := data.Float64()
+	if cfg.Compositing == sumCompositing {
+		density /= float64(cfg.Layers)
+	}
+	return density
+}
+
+// Writes the formatted message to the log, if any.
+func (cfg *Config) logf(format string, args ...interface{}) {
+	if cfg.Log != nil {
+		fmt.Fprintf(cfg.Log, format, args...)
+	}
+}
+
+// Returns the opacity of a layer with the given density relative to the max, interpolating the opacity transfer
+// function.
+func (cfg *Config) opacityAt(density float64) float64 {
+	pts := cfg.Opacity
+	if density <= pts[0][0] {
+		return pts[0][1]
+	}
+	for k := 1; k < len(pts); k++ {
+		if density <= pts[k][0] {
+			t := (density - pts[k-1][0]) / (pts[k][0] - pts[k-1][0])
+			return pts[k-1][1] + t*(pts[k][1]-pts[k-1][1])
+		}
+	}
+	return pts[len(pts)-1][1]
+}
+
+const degToRad = math.Pi / 180.0
+
+const (
+	// Valid values of config.Orbitals.
+	complexOrbitals = "complex"
+	realOrbitals    = "real"
+
+	// Valid values of config.Evaluation.
+	autoEvaluation = "auto"
+	bigEvaluation  = "big"
+
+	// Valid values of config.Scale.
+	linearScale = "linear"
+	logScale    = "log"
+
+	// Valid values of config.Normalization.
+	maxNormalization      = "max"
+	absoluteNormalization = "absolute"
+
+	// Valid values of config.ColorMode.
+	densityColorMode = "density"
+	phaseColorMode   = "phase"
+	signedColorMode  = "signed"
+
+	// Valid values of config.Space.
+	positionSpace = "position"
+	momentumSpace = "momentum"
+
+	// Valid values of config.Projection.
+	orthographicProjection = "orthographic"
+	perspectiveProjection  = "perspective"
+
+	// Valid values of config.PanelNormalization.
+	separatePanelNormalization = "separate"
+	sharedPanelNormalization   = "shared"
+
+	// Valid values of stereo.Mode.
+	anaglyphStereo   = "anaglyph"
+	sideBySideStereo = "sideBySide"
+
+	// Valid values of config.Compositing.
+	sumCompositing      = "sum"
+	emissionCompositing = "emission"
+	mipCompositing      = "mip"
+	sliceCompositing    = "slice"
+)
+
+// ConfigError reports an invalid config, naming the offending field.
+type ConfigError struct {
+	// JSON path of the offending field, e.g., "imageSize", "animation.frames" or "terms[2].l".
+	Field string
+	// Description of the problem, e.g., "invalid imageSize: 0".
+	Message string
+}
+
+func (e *ConfigError) Error() string { return e.Message }
+
+func fieldError(field, message string) *ConfigError {
+	return &ConfigError{Field: field, Message: message}
+}
+
+func invalidField(field string, value interface{}) *ConfigError {
+	return fieldError(field, fmt.Sprintf("invalid %v: %v", field, value))
+}
+
+func missingField(field string) *ConfigError {
+	return fieldError(field, fmt.Sprintf("missing %v", field))
+}
+
+// Checks the preview of the config and fills in its defaults.
+func (cfg *Config) validatePreview(pv *Preview) error {
+	if pv.ImageSize < 0 || pv.ImageSize == 1 {
+		return invalidField("preview.imageSize", pv.ImageSize)
+	}
+	if pv.ImageSize == 0 {
+		pv.ImageSize = 200
+		if cfg.ImageSize < pv.ImageSize {
+			pv.ImageSize = cfg.ImageSize
+		}
+	}
+	if pv.File == "" {
+		ext := filepath.Ext(cfg.OutputFile)
+		pv.File = strings.TrimSuffix(cfg.OutputFile, ext) + "-preview" + ext
+	}
+	if pv.File == cfg.OutputFile {
+		return invalidField("preview.file", pv.File)
+	}
+	return nil
+}
+
+// All layers must be in front of the camera.
+func (cfg *Config) checkCameraDistance() error {
+	if cfg.CameraDistance <= float64((cfg.Layers-1)/2)*cfg.LayerDist.Value {
+		return invalidField("cameraDistance", cfg.CameraDistance)
+	}
+	return nil
+}
+
+// ParseConfigFile reads, parses and validates the config file, see ParseConfig.
+func ParseConfigFile(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses and validates the JSON config, see Validate.
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the config, reporting an invalid config as a *ConfigError naming the offending field. The config is
+// left unchanged, ParseConfig, Render and Run validate it, and Render and Run fill in the defaults of their own copy,
+// so the same Config can be changed and rendered again.
+func (cfg *Config) Validate() error {
+	_, err := cfg.validated()
+	return err
+}
+
+// Returns the validated copy of the config, with the defaults filled in, the angles converted to radians and the
+// heatmap loaded, leaving cfg unchanged.
+func (cfg *Config) validated() (*Config, error) {
+	// The nested configs that get defaults are copied too.
+	c := *cfg
+	if cfg.Stereo != nil {
+		st := *cfg.Stereo
+		c.Stereo = &st
+	}
+	if cfg.Preview != nil {
+		pv := *cfg.Preview
+		c.Preview = &pv
+	}
+	// The jobs of a sweep are derived from the JSON config, and checkpoints and workers are tied to its hash.
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	c.source = data
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (cfg *Config) validate() error {
+	cfg.fingerprint = sha256.Sum256(cfg.source)
+	// Convert angles into radians.
+	cfg.CameraTheta *= degToRad
+	cfg.CameraPhi *= degToRad
+	cfg.CameraRoll *= degToRad
+	cfg.FOVAngle *= degToRad
+
+	if cfg.ImageSize <= 1 {
+		return invalidField("imageSize", cfg.ImageSize)
+	}
+	if !cfg.LayerDist.Auto && cfg.LayerDist.Value <= 0 {
+		return invalidField("layerDist", cfg.LayerDist.Value)
+	}
+	if cfg.Layers <= 0 || cfg.Layers%2 == 0 {
+		return invalidField("layers", cfg.Layers)
+	}
+	switch cfg.Projection {
+	case "", orthographicProjection:
+		cfg.Projection = orthographicProjection
+		if !cfg.FOVSize.Auto && cfg.FOVSize.Value <= 0 {
+			return invalidField("fovSize", cfg.FOVSize.Value)
+		}
+	case perspectiveProjection:
+		if cfg.FOVSize.Auto {
+			return fieldError("fovSize", "invalid fovSize: auto requires orthographic projection")
+		}
+		if cfg.FOVAngle <= 0 || cfg.FOVAngle >= math.Pi {
+			return invalidField("fovAngle", cfg.FOVAngle/degToRad)
+		}
+		// All layers must be in front of the camera, checked by resolveAuto() for auto layerDist.
+		if !cfg.LayerDist.Auto {
+			if err := cfg.checkCameraDistance(); err != nil {
+				return err
+			}
+		}
+	default:
+		return invalidField("projection", cfg.Projection)
+	}
+	switch cfg.Compositing {
+	case "":
+		cfg.Compositing = sumCompositing
+	case sumCompositing, emissionCompositing, mipCompositing, sliceCompositing:
+	default:
+		return invalidField("compositing", cfg.Compositing)
+	}
+	if cfg.Supersampling < 0 {
+		return invalidField("supersampling", cfg.Supersampling)
+	}
+	if cfg.Supersampling == 0 {
+		cfg.Supersampling = 1
+	}
+	if cfg.AdaptiveThreshold < 0 || cfg.AdaptiveThreshold >= 1 ||
+		(cfg.AdaptiveThreshold > 0 && cfg.Supersampling == 1) {
+		return invalidField("adaptiveThreshold", cfg.AdaptiveThreshold)
+	}
+	if len(cfg.Opacity) == 0 {
+		cfg.Opacity = [][2]float64{{0, 0}, {1, 0.3}}
+	}
+	for k, pt := range cfg.Opacity {
+		if pt[0] < 0 || pt[0] > 1 || (k > 0 && pt[0] <= cfg.Opacity[k-1][0]) {
+			return invalidField(fmt.Sprintf("opacity[%v]", k), pt)
+		}
+		if pt[1] < 0 || pt[1] > 1 {
+			return invalidField(fmt.Sprintf("opacity[%v]", k), pt)
+		}
+	}
+	if cfg.SliceLayer < -(cfg.Layers-1)/2 || cfg.SliceLayer > (cfg.Layers-1)/2 {
+		return invalidField("sliceLayer", cfg.SliceLayer)
+	}
+	if cfg.FloatPrec == 0 {
+		return invalidField("floatPrec", cfg.FloatPrec)
+	}
+	if cfg.Concurrency <= 0 {
+		return invalidField("concurrency", cfg.Concurrency)
+	}
+	if cfg.CheckpointInterval < 0 {
+		return invalidField("checkpointInterval", cfg.CheckpointInterval)
+	}
+	if cfg.CheckpointInterval == 0 {
+		cfg.CheckpointInterval = 60
+	}
+	if cfg.TileSize < 0 {
+		return invalidField("tileSize", cfg.TileSize)
+	}
+	if cfg.TileSize == 0 {
+		cfg.TileSize = 64
+	}
+	if cfg.TileTimeout < 0 {
+		return invalidField("tileTimeout", cfg.TileTimeout)
+	}
+	if cfg.TileTimeout == 0 {
+		cfg.TileTimeout = 3600
+	}
+	if cfg.Exposure <= 0 {
+		return invalidField("exposure", cfg.Exposure)
+	}
+	switch cfg.Normalization {
+	case "", maxNormalization:
+		cfg.Normalization = maxNormalization
+	case absoluteNormalization:
+		if cfg.AbsoluteMax <= 0 {
+			return invalidField("absoluteMax", cfg.AbsoluteMax)
+		}
+	default:
+		return invalidField("normalization", cfg.Normalization)
+	}
+	switch cfg.Scale {
+	case "":
+		cfg.Scale = linearScale
+	case linearScale, logScale:
+	default:
+		return invalidField("scale", cfg.Scale)
+	}
+	if cfg.LogDecades < 0 {
+		return invalidField("logDecades", cfg.LogDecades)
+	}
+	if cfg.LogDecades == 0 {
+		cfg.LogDecades = 6
+	}
+	if cfg.ClipHigh == 0 {
+		cfg.ClipHigh = 1
+	}
+	if cfg.ClipLow < 0 || cfg.ClipLow >= cfg.ClipHigh {
+		return invalidField("clipLow", cfg.ClipLow)
+	}
+	if cfg.ClipHigh > 1 {
+		return invalidField("clipHigh", cfg.ClipHigh)
+	}
+
+	switch cfg.Evaluation {
+	case "":
+		cfg.Evaluation = autoEvaluation
+	case autoEvaluation, bigEvaluation:
+	default:
+		return invalidField("evaluation", cfg.Evaluation)
+	}
+	switch cfg.ColorMode {
+	case "":
+		cfg.ColorMode = densityColorMode
+	case densityColorMode, phaseColorMode, signedColorMode:
+	default:
+		return invalidField("colorMode", cfg.ColorMode)
+	}
+
+	if a := cfg.Animation; a != nil {
+		if a.Frames <= 1 {
+			return invalidField("animation.frames", a.Frames)
+		}
+		if a.EndTime <= a.StartTime {
+			return invalidField("animation.endTime", a.EndTime)
+		}
+		if a.GIFFile == "" {
+			return missingField("animation.gifFile")
+		}
+		if a.FrameDelay <= 0 {
+			return invalidField("animation.frameDelay", a.FrameDelay)
+		}
+	}
+
+	if tt := cfg.Turntable; tt != nil {
+		if cfg.Animation != nil {
+			return fieldError("turntable", "turntable cannot be combined with animation")
+		}
+		if tt.Frames <= 1 {
+			return invalidField("turntable.frames", tt.Frames)
+		}
+		if tt.GIFFile == "" {
+			return missingField("turntable.gifFile")
+		}
+		if tt.FrameDelay <= 0 {
+			return invalidField("turntable.frameDelay", tt.FrameDelay)
+		}
+	}
+
+	if st := cfg.Stereo; st != nil {
+		if st.Mode != anaglyphStereo && st.Mode != sideBySideStereo {
+			return invalidField("stereo.mode", st.Mode)
+		}
+		if st.Separation < 0 || st.Separation >= 90 {
+			return invalidField("stereo.separation", st.Separation)
+		}
+		if st.Separation == 0 {
+			st.Separation = 4
+		}
+		st.Separation *= degToRad
+	}
+
+	for k, p := range cfg.Panels {
+		if p.Normal != nil && *p.Normal == [3]float64{} {
+			return invalidField(fmt.Sprintf("panels[%v].normal", k), *p.Normal)
+		}
+	}
+	if len(cfg.Panels) > 0 {
+		if cfg.Turntable != nil || cfg.Stereo != nil {
+			return fieldError("panels", "panels cannot be combined with turntable or stereo")
+		}
+		if cfg.CheckpointFile != "" || cfg.RawOutput != nil {
+			return fieldError("panels", "panels cannot be combined with checkpointFile or rawOutput")
+		}
+	}
+	if cfg.PanelColumns < 0 {
+		return invalidField("panelColumns", cfg.PanelColumns)
+	}
+	if cfg.PanelColumns == 0 {
+		cfg.PanelColumns = len(cfg.Panels)
+	}
+	switch cfg.PanelNormalization {
+	case "":
+		cfg.PanelNormalization = separatePanelNormalization
+	case separatePanelNormalization, sharedPanelNormalization:
+	default:
+		return invalidField("panelNormalization", cfg.PanelNormalization)
+	}
+
+	if ro := cfg.RawOutput; ro != nil {
+		if ro.File == "" {
+			return missingField("rawOutput.file")
+		}
+		if len(ro.Formats) == 0 {
+			return missingField("rawOutput.formats")
+		}
+		for k, format := range ro.Formats {
+			if format != "npy" && format != "csv" && format != "vtk" {
+				return invalidField(fmt.Sprintf("rawOutput.formats[%v]", k), format)
+			}
+		}
+	}
+
+	if iso := cfg.Isosurface; iso != nil {
+		if iso.Extent <= 0 {
+			return invalidField("isosurface.extent", iso.Extent)
+		}
+		if iso.Resolution <= 1 {
+			return invalidField("isosurface.resolution", iso.Resolution)
+		}
+		if iso.Enclosed <= 0 || iso.Enclosed >= 1 {
+			return invalidField("isosurface.enclosed", iso.Enclosed)
+		}
+		if iso.File == "" {
+			return missingField("isosurface.file")
+		}
+		if len(iso.Formats) == 0 {
+			return missingField("isosurface.formats")
+		}
+		for k, format := range iso.Formats {
+			if format != "obj" && format != "ply" && format != "stl" {
+				return invalidField(fmt.Sprintf("isosurface.formats[%v]", k), format)
+			}
+		}
+	}
+
+	switch cfg.Space {
+	case "":
+		cfg.Space = positionSpace
+	case positionSpace, momentumSpace:
+	default:
+		return invalidField("space", cfg.Space)
+	}
+	if sw := cfg.Sweep; sw != nil {
+		if len(sw.N) == 0 && len(sw.Overrides) == 0 {
+			return fieldError("sweep", "missing sweep.n or sweep.overrides")
+		}
+		// The l and m lists only restrict the states of sweep.n.
+		if len(sw.N) == 0 && len(sw.L) > 0 {
+			return fieldError("sweep.l", "invalid sweep.l: requires sweep.n")
+		}
+		if len(sw.N) == 0 && len(sw.M) > 0 {
+			return fieldError("sweep.m", "invalid sweep.m: requires sweep.n")
+		}
+		maxN := 0
+		for k, n := range sw.N {
+			if n <= 0 {
+				return invalidField(fmt.Sprintf("sweep.n[%v]", k), n)
+			}
+			if n > maxN {
+				maxN = n
+			}
+		}
+		// Every listed l and m is taken by some state of sweep.n.
+		maxL := maxN - 1
+		if len(sw.L) > 0 {
+			maxL = 0
+		}
+		for k, l := range sw.L {
+			if l < 0 || l >= maxN {
+				return invalidField(fmt.Sprintf("sweep.l[%v]", k), l)
+			}
+			if l > maxL {
+				maxL = l
+			}
+		}
+		for k, m := range sw.M {
+			if m < -maxL || m > maxL {
+				return invalidField(fmt.Sprintf("sweep.m[%v]", k), m)
+			}
+		}
+		if len(sw.N) > 0 && len(cfg.Terms) > 0 {
+			return fieldError("sweep.n", "sweep.n cannot be combined with terms")
+		}
+		if sw.IndexFile == "" {
+			return missingField("sweep.indexFile")
+		}
+		// Every job writes a single image of its own.
+		if cfg.Animation != nil || cfg.Turntable != nil || len(cfg.Panels) > 0 {
+			return fieldError("sweep", "sweep cannot be combined with animation, turntable or panels")
+		}
+		if cfg.CheckpointFile != "" || cfg.RawOutput != nil || cfg.Preview != nil {
+			return fieldError("sweep", "sweep cannot be combined with checkpointFile, rawOutput or preview")
+		}
+	}
+
+	if cfg.Preview != nil {
+		if err := cfg.validatePreview(cfg.Preview); err != nil {
+			return err
+		}
+	}
+
+	// The auto lengths are derived from the radial distribution in position space.
+	if (cfg.FOVSize.Auto || cfg.LayerDist.Auto) && cfg.Space != positionSpace {
+		return fieldError("space", "auto fovSize and layerDist require position space")
+	}
+
+	if pc := cfg.PointCloud; pc != nil {
+		if pc.Points <= 0 {
+			return invalidField("pointCloud.points", pc.Points)
+		}
+		if pc.File == "" {
+			return missingField("pointCloud.file")
+		}
+		if len(pc.Formats) == 0 {
+			return missingField("pointCloud.formats")
+		}
+		for k, format := range pc.Formats {
+			if format != "csv" && format != "ply" {
+				return invalidField(fmt.Sprintf("pointCloud.formats[%v]", k), format)
+			}
+		}
+		// The radial and angular distributions only separate for a single state in position space.
+		if len(cfg.Terms) > 1 {
+			return fieldError("pointCloud", "pointCloud requires a single (n,l,m) state")
+		}
+		if cfg.Space != positionSpace {
+			return fieldError("pointCloud", "pointCloud requires position space")
+		}
+	}
+
+	if cfg.Z < 0 {
+		return invalidField("z", cfg.Z)
+	}
+	if cfg.Z == 0 {
+		cfg.Z = 1
+	}
+	if cfg.ReducedMass < 0 {
+		return invalidField("reducedMass", cfg.ReducedMass)
+	}
+	if cfg.ReducedMass == 0 {
+		cfg.ReducedMass = 1
+	}
+
+	// A single (n,l,m) state is the superposition with one term. The state of a sweep may be left to its jobs.
+	if len(cfg.Terms) == 0 && (cfg.Sweep == nil || cfg.N != 0) {
+		if cfg.N == 0 {
+			return fieldError("n", "missing n or terms")
+		}
+		if cfg.N < 0 {
+			return invalidField("n", cfg.N)
+		}
+		if cfg.L < 0 || cfg.L >= cfg.N {
+			return invalidField("l", cfg.L)
+		}
+		if cfg.M < -cfg.L || cfg.M > cfg.L {
+			return invalidField("m", cfg.M)
+		}
+		cfg.Terms = []Term{{N: cfg.N, L: cfg.L, M: cfg.M, Re: 1.0}}
+	}
+	// Validate quantum numbers and amplitudes.
+	seen := make(map[[3]int]bool)
+	norm := 0.0
+	for k, t := range cfg.Terms {
+		if t.N <= 0 {
+			return invalidField(fmt.Sprintf("terms[%v].n", k), t.N)
+		}
+		if t.L < 0 || t.L >= t.N {
+			return invalidField(fmt.Sprintf("terms[%v].l", k), t.L)
+		}
+		if t.M < -t.L || t.M > t.L {
+			return invalidField(fmt.Sprintf("terms[%v].m", k), t.M)
+		}
+		key := [3]int{t.N, t.L, t.M}
+		if seen[key] {
+			field := fmt.Sprintf("terms[%v]", k)
+			return fieldError(field, fmt.Sprintf("duplicate %v: (%v,%v,%v)", field, t.N, t.L, t.M))
+		}
+		seen[key] = true
+		norm += t.Re*t.Re + t.Im*t.Im
+	}
+	if len(cfg.Terms) > 0 && norm == 0 {
+		return fieldError("terms", "invalid terms: all amplitudes are zero")
+	}
+	switch cfg.Orbitals {
+	case "":
+		cfg.Orbitals = complexOrbitals
+	case complexOrbitals, realOrbitals:
+	default:
+		return invalidField("orbitals", cfg.Orbitals)
+	}
+
+	sources := 0
+	for _, set := range []bool{cfg.HeatmapFile != "", cfg.Heatmap != "", len(cfg.Gradient) != 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fieldError("heatmap", "exactly one of heatmapFile, heatmap and gradient must be set")
+	}
+	if cfg.Heatmap != "" && builtinHeatmaps[cfg.Heatmap] == nil {
+		return invalidField("heatmap", cfg.Heatmap)
+	}
+	if len(cfg.Gradient) == 1 {
+		return fieldError("gradient", "invalid gradient: at least 2 control points are needed")
+	}
+	for k, stop := range cfg.Gradient {
+		if stop.Pos < 0 || stop.Pos > 1 || (k > 0 && stop.Pos <= cfg.Gradient[k-1].Pos) {
+			return invalidField(fmt.Sprintf("gradient[%v].pos", k), stop.Pos)
+		}
+		if _, err := parseHexColor(stop.Color); err != nil {
+			return invalidField(fmt.Sprintf("gradient[%v].color", k), err)
+		}
+	}
+	return cfg.loadHeatmap()
+}
@@ -0,0 +1,143 @@
+package hydrogen
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigErrors(t *testing.T) {
+	noState := map[string]interface{}{"n": nil, "l": nil, "m": nil}
+	withState := func(fields map[string]interface{}) map[string]interface{} {
+		for k, v := range noState {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+		return fields
+	}
+	for _, c := range []struct {
+		name   string
+		fields map[string]interface{}
+		field  string
+	}{
+		{"imageSize", map[string]interface{}{"imageSize": 0}, "imageSize"},
+		{"layers", map[string]interface{}{"layers": 0}, "layers"},
+		{"fovSize", map[string]interface{}{"fovSize": -1}, "fovSize"},
+		{"concurrency", map[string]interface{}{"concurrency": 0}, "concurrency"},
+		{"tileTimeout", map[string]interface{}{"tileTimeout": -1}, "tileTimeout"},
+		{"projection", map[string]interface{}{"projection": "fisheye"}, "projection"},
+		{"compositing", map[string]interface{}{"compositing": "max"}, "compositing"},
+		{"missing state", withState(map[string]interface{}{}), "n"},
+		{"negative n", map[string]interface{}{"n": -1}, "n"},
+		{"l", map[string]interface{}{"l": 3}, "l"},
+		{"m", map[string]interface{}{"m": -3}, "m"},
+		{"terms l", withState(map[string]interface{}{
+			"terms": []Term{{N: 2, L: 1, Re: 1}, {N: 2, L: 2, Re: 1}},
+		}), "terms[1].l"},
+		{"duplicate terms", withState(map[string]interface{}{
+			"terms": []Term{{N: 2, Re: 1}, {N: 2, Im: 1}},
+		}), "terms[1]"},
+		{"zero terms", withState(map[string]interface{}{"terms": []Term{{N: 2}, {N: 3}}}), "terms"},
+		{"orbitals", map[string]interface{}{"orbitals": "cubic"}, "orbitals"},
+		{"space", map[string]interface{}{"space": "phase"}, "space"},
+		{"heatmap", map[string]interface{}{"heatmap": "rainbow"}, "heatmap"},
+		{"two heatmaps", map[string]interface{}{"gradient": []GradientStop{{0, "#000000"}, {1, "#ffffff"}}}, "heatmap"},
+		{"gradient pos", map[string]interface{}{
+			"heatmap": nil, "gradient": []GradientStop{{0, "#000000"}, {2, "#ffffff"}},
+		}, "gradient[1].pos"},
+		{"gradient color", map[string]interface{}{
+			"heatmap": nil, "gradient": []GradientStop{{0, "black"}, {1, "#ffffff"}},
+		}, "gradient[0].color"},
+		{"animation", map[string]interface{}{
+			"animation": map[string]interface{}{"endTime": 10, "gifFile": "a.gif"},
+		}, "animation.frames"},
+		{"animation gif", map[string]interface{}{
+			"animation": map[string]interface{}{"endTime": 10, "frames": 2},
+		}, "animation.gifFile"},
+		{"turntable and animation", map[string]interface{}{
+			"animation": map[string]interface{}{"endTime": 10, "frames": 2, "gifFile": "a.gif", "frameDelay": 5},
+			"turntable": map[string]interface{}{"frames": 2, "gifFile": "t.gif", "frameDelay": 5},
+		}, "turntable"},
+		{"panels normal", map[string]interface{}{"panels": []Panel{{Normal: &[3]float64{}}}}, "panels[0].normal"},
+		{"rawOutput formats", map[string]interface{}{
+			"rawOutput": RawOutput{File: "raw", Formats: []string{"npy", "hdf5"}},
+		}, "rawOutput.formats[1]"},
+		{"isosurface file", map[string]interface{}{
+			"isosurface": Isosurface{Extent: 10, Resolution: 10, Enclosed: 0.9, Formats: []string{"obj"}},
+		}, "isosurface.file"},
+		{"pointCloud terms", withState(map[string]interface{}{
+			"terms":      []Term{{N: 2, Re: 1}, {N: 3, Re: 1}},
+			"pointCloud": PointCloud{Points: 10, File: "points", Formats: []string{"csv"}},
+		}), "pointCloud"},
+		{"preview", map[string]interface{}{"preview": Preview{ImageSize: 1}}, "preview.imageSize"},
+		{"sweep", map[string]interface{}{"sweep": map[string]interface{}{"indexFile": "index.html"}}, "sweep"},
+		{"sweep n", map[string]interface{}{"sweep": map[string]interface{}{
+			"n": []int{2, 0}, "indexFile": "index.html",
+		}}, "sweep.n[1]"},
+		{"sweep l", map[string]interface{}{"sweep": map[string]interface{}{
+			"l": []int{1}, "overrides": []interface{}{map[string]interface{}{}}, "indexFile": "index.html",
+		}}, "sweep.l"},
+		{"sweep m", map[string]interface{}{"sweep": map[string]interface{}{
+			"m": []int{0}, "overrides": []interface{}{map[string]interface{}{}}, "indexFile": "index.html",
+		}}, "sweep.m"},
+		{"sweep l range", map[string]interface{}{"sweep": map[string]interface{}{
+			"n": []int{2, 3}, "l": []int{1, 3}, "indexFile": "index.html",
+		}}, "sweep.l[1]"},
+		{"sweep m range", map[string]interface{}{"sweep": map[string]interface{}{
+			"n": []int{4}, "l": []int{0, 1}, "m": []int{-2}, "indexFile": "index.html",
+		}}, "sweep.m[0]"},
+		{"sweep index", map[string]interface{}{"sweep": map[string]interface{}{"n": []int{2}}}, "sweep.indexFile"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseConfig(testConfigData(t, c.fields))
+			var ce *ConfigError
+			if !errors.As(err, &ce) {
+				t.Fatalf("error %v is not a *ConfigError", err)
+			}
+			if ce.Field != c.field {
+				t.Errorf("error %q names %v, expecting %v", ce.Message, ce.Field, c.field)
+			}
+			if !strings.Contains(ce.Message, c.field) {
+				t.Errorf("error %q doesn't mention %v", ce.Message, c.field)
+			}
+		})
+	}
+}
+
+func TestParseConfigSyntaxError(t *testing.T) {
+	_, err := ParseConfig([]byte(`{"imageSize": "large"}`))
+	var ce *ConfigError
+	if err == nil || errors.As(err, &ce) {
+		t.Errorf("error %v, expecting an unmarshalling error", err)
+	}
+}
+
+// Validate leaves the config unchanged, valid or not, and a Config built in Go is validated like a parsed one.
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		ImageSize: 8, FOVSize: AutoLength{Value: 30}, CameraTheta: 90, Layers: 1, LayerDist: AutoLength{Value: 1},
+	}
+	err := cfg.Validate()
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Fatalf("error %v is not a *ConfigError", err)
+	}
+	cfg.FloatPrec, cfg.Concurrency, cfg.Heatmap, cfg.Exposure = testPrec, 1, "viridis", 1
+	cfg.N, cfg.L, cfg.M = 2, 1, 1
+	want := *cfg
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("valid config changed to %+v", cfg)
+	}
+	c, err := cfg.validated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CameraTheta != 90*degToRad || len(c.Terms) != 1 {
+		t.Errorf("validated copy has cameraTheta %v and terms %v", c.CameraTheta, c.Terms)
+	}
+}
@@ -0,0 +1,350 @@
+package hydrogen
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+// Rectangle [X0,X1)x[Y0,Y1) of pixels.
+type tile struct {
+	X0, Y0, X1, Y1 int
+}
+
+// Splits the image into tiles of at most size x size pixels.
+func tiles(imageSize, size int) []tile {
+	var ts []tile
+	for y := 0; y < imageSize; y += size {
+		for x := 0; x < imageSize; x += size {
+			ts = append(ts, tile{X0: x, Y0: y, X1: minInt(x+size, imageSize), Y1: minInt(y+size, imageSize)})
+		}
+	}
+	return ts
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// First message from the worker to the coordinator.
+type helloMsg struct {
+	// Fingerprint of the worker's config, which must match the coordinator's so that the results are identical.
+	Fingerprint [32]byte
+}
+
+// Message from the coordinator to the worker, assigning a tile.
+type tileMsg struct {
+	Tile tile
+	// No more tiles, the worker should exit.
+	Done bool
+	// Set if the worker is rejected.
+	Err string
+}
+
+// Message from the worker to the coordinator with the rendered tile.
+type tileResultMsg struct {
+	Tile tile
+	// Number of pixels in the tile that were escalated to big.Float.
+	Escalated int
+	// Indexed by frame, then by pixel within the tile in row-major order.
+	Data [][]*big.Float
+	// Same as Data, nil unless phase coloring.
+	AmpsRe, AmpsIm [][]*big.Float
+	// Indexed by frame, then by p*Layers+k for pixel p and layer k, nil unless the raw per-layer output is needed.
+	Layers [][]float64
+}
+
+// Renders the tile using all cfg.Concurrency goroutines.
+func (rd *renderer) renderTile(t tile) *tileResultMsg {
+	w, h := t.X1-t.X0, t.Y1-t.Y0
+	res := &tileResultMsg{Tile: t, Data: make([][]*big.Float, rd.frameCount())}
+	if rd.cfg.keepAmps() {
+		res.AmpsRe = make([][]*big.Float, rd.frameCount())
+		res.AmpsIm = make([][]*big.Float, rd.frameCount())
+	}
+	if rd.cfg.keepLayers() {
+		res.Layers = make([][]float64, rd.frameCount())
+	}
+	for f := 0; f < rd.frameCount(); f++ {
+		res.Data[f] = make([]*big.Float, w*h)
+		if res.AmpsRe != nil {
+			res.AmpsRe[f] = make([]*big.Float, w*h)
+			res.AmpsIm[f] = make([]*big.Float, w*h)
+		}
+		if res.Layers != nil {
+			res.Layers[f] = make([]float64, w*h*rd.cfg.Layers)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(rd.cfg.Concurrency)
+	for g := 0; g < rd.cfg.Concurrency; g++ {
+		go func(shard int) {
+			defer wg.Done()
+			for p := shard; p < len(res.Data[0]); p += rd.cfg.Concurrency {
+				px := rd.pixel(t.X0+p%w, t.Y0+p/w, nil)
+				for f := range px.data {
+					res.Data[f][p] = px.data[f]
+					if px.amps != nil {
+						res.AmpsRe[f][p] = px.amps[f].re
+						res.AmpsIm[f][p] = px.amps[f].im
+					}
+					if px.layers != nil {
+						copy(res.Layers[f][p*rd.cfg.Layers:], px.layers[f])
+					}
+				}
+				if px.escalated {
+					mu.Lock()
+					res.Escalated++
+					mu.Unlock()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	return res
+}
+
+// Checks that the result covers tile t with all the data the frames need, so that storing it cannot fail.
+func checkTileResult(t tile, res *tileResultMsg, frames []*frame, layers int) error {
+	if res.Tile != t {
+		return fmt.Errorf("result for tile %v instead of %v", res.Tile, t)
+	}
+	if len(res.Data) != len(frames) || (res.AmpsRe == nil) != (frames[0].amps == nil) ||
+		(res.Layers == nil) != (frames[0].layers == nil) {
+		return fmt.Errorf("unexpected frames in the result for tile %v", t)
+	}
+	if (res.AmpsRe != nil && (len(res.AmpsRe) != len(frames) || len(res.AmpsIm) != len(frames))) ||
+		(res.Layers != nil && len(res.Layers) != len(frames)) {
+		return fmt.Errorf("unexpected frames in the result for tile %v", t)
+	}
+	pixels := (t.X1 - t.X0) * (t.Y1 - t.Y0)
+	for f := range frames {
+		data := [][]*big.Float{res.Data[f]}
+		if res.AmpsRe != nil {
+			data = append(data, res.AmpsRe[f], res.AmpsIm[f])
+		}
+		for _, values := range data {
+			if len(values) != pixels {
+				return fmt.Errorf("unexpected size of the result for tile %v", t)
+			}
+			for _, v := range values {
+				if v == nil {
+					return fmt.Errorf("missing values in the result for tile %v", t)
+				}
+			}
+		}
+		if res.Layers != nil && len(res.Layers[f]) != pixels*layers {
+			return fmt.Errorf("unexpected size of the layers in the result for tile %v", t)
+		}
+	}
+	return nil
+}
+
+// Listens on addr and assigns tiles to the connecting workers until all tiles are rendered, see serveTiles.
+func coordinate(ctx context.Context, rd *renderer, addr string) ([]*frame, int, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to listen: %w", err)
+	}
+	return serveTiles(ctx, rd, ln)
+}
+
+// Assigns tiles to the workers connecting to ln until all tiles are rendered, then tells the connected workers to exit
+// and closes ln. A tile is put back into the queue for other workers if its worker fails, or takes longer than
+// cfg.TileTimeout seconds. Returns the assembled frames and the number of escalated pixels, or ctx.Err() once ctx is
+// done, after which no more tiles are assigned.
+func serveTiles(ctx context.Context, rd *renderer, ln net.Listener) ([]*frame, int, error) {
+	cfg := rd.cfg
+	// Cancelled on return, which also disconnects the workers still connected.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ts := tiles(cfg.ImageSize, cfg.TileSize)
+	queue := make(chan tile, len(ts))
+	for _, t := range ts {
+		queue <- t
+	}
+	frames := rd.newFrames()
+
+	defer ln.Close()
+	cfg.logf("waiting for workers on %v, %v tiles\n", ln.Addr(), len(ts))
+
+	var wg sync.WaitGroup
+	progress := showProgress(cfg, len(ts), &wg)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	completed, escalated := 0, 0
+
+	// Stores the tile into the frames, safe since no two results cover the same pixel.
+	store := func(res *tileResultMsg) {
+		t := res.Tile
+		w := t.X1 - t.X0
+		for p := range res.Data[0] {
+			px := &pixelResult{data: make([]*big.Float, len(frames))}
+			if res.AmpsRe != nil {
+				px.amps = make([]complexFloat, len(frames))
+			}
+			if res.Layers != nil {
+				px.layers = make([][]float64, len(frames))
+			}
+			for f := range frames {
+				px.data[f] = res.Data[f][p]
+				if px.amps != nil {
+					px.amps[f] = complexFloat{re: res.AmpsRe[f][p], im: res.AmpsIm[f][p]}
+				}
+				if px.layers != nil {
+					px.layers[f] = res.Layers[f][p*cfg.Layers : (p+1)*cfg.Layers]
+				}
+			}
+			rd.store(frames, t.X0+p%w, t.Y0+p/w, px)
+		}
+	}
+
+	// Counts the accepting goroutine and the connections being served.
+	var serveWg sync.WaitGroup
+	serve := func(conn net.Conn) {
+		defer serveWg.Done()
+		defer conn.Close()
+		// Unblocks the exchange with the worker once ctx is done, or the wait for its hello once all tiles are done.
+		greeted := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-done:
+				select {
+				case <-greeted:
+					// The worker is told to exit below.
+					<-ctx.Done()
+				default:
+				}
+			}
+			conn.Close()
+		}()
+		enc, dec := gob.NewEncoder(conn), gob.NewDecoder(conn)
+		var hello helloMsg
+		if err := dec.Decode(&hello); err != nil {
+			return
+		}
+		close(greeted)
+		if hello.Fingerprint != cfg.fingerprint {
+			cfg.logf("\nrejected worker %v with a different config\n", conn.RemoteAddr())
+			enc.Encode(&tileMsg{Done: true, Err: "config differs from the coordinator's"})
+			return
+		}
+		for {
+			select {
+			case <-done:
+				enc.Encode(&tileMsg{Done: true})
+				return
+			case <-ctx.Done():
+				return
+			case t := <-queue:
+				res := &tileResultMsg{}
+				// A worker that hangs without disconnecting gives up its tile after the timeout.
+				conn.SetDeadline(time.Now().Add(time.Duration(cfg.TileTimeout) * time.Second))
+				err := enc.Encode(&tileMsg{Tile: t})
+				if err == nil {
+					err = dec.Decode(res)
+				}
+				if err == nil {
+					err = checkTileResult(t, res, frames, cfg.Layers)
+				}
+				conn.SetDeadline(time.Time{})
+				if err != nil {
+					queue <- t
+					if ctx.Err() == nil {
+						cfg.logf("\nworker %v failed, retrying tile %v: %v\n", conn.RemoteAddr(), t, err)
+					}
+					return
+				}
+				store(res)
+				mu.Lock()
+				completed++
+				escalated += res.Escalated
+				if completed == len(ts) {
+					close(done)
+				}
+				mu.Unlock()
+				progress <- struct{}{}
+			}
+		}
+	}
+
+	serveWg.Add(1)
+	go func() {
+		defer serveWg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			serveWg.Add(1)
+			go serve(conn)
+		}
+	}()
+
+	select {
+	case <-done:
+		// The connected workers are told to exit before they are disconnected.
+		ln.Close()
+		serveWg.Wait()
+		wg.Wait()
+		return frames, escalated, nil
+	case <-ctx.Done():
+		// No tile is stored once all connections are closed.
+		ln.Close()
+		serveWg.Wait()
+		close(progress)
+		wg.Wait()
+		return nil, 0, ctx.Err()
+	}
+}
+
+// Connects to the coordinator at addr and renders the assigned tiles until told to stop, or until ctx is done. Losing
+// the connection before is an error.
+func work(ctx context.Context, rd *renderer, addr string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to coordinator: %w", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	enc, dec := gob.NewEncoder(conn), gob.NewDecoder(conn)
+	if err := enc.Encode(&helloMsg{Fingerprint: rd.cfg.fingerprint}); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	for {
+		msg := &tileMsg{}
+		if err := dec.Decode(msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("lost connection to coordinator: %w", err)
+		}
+		if msg.Err != "" {
+			return fmt.Errorf("rejected by coordinator: %v", msg.Err)
+		}
+		if msg.Done {
+			rd.cfg.logf("all tiles done\n")
+			return nil
+		}
+		if err := enc.Encode(rd.renderTile(msg.Tile)); err != nil {
+			return fmt.Errorf("failed to send tile %v: %w", msg.Tile, err)
+		}
+		rd.cfg.logf("rendered tile %v\n", msg.Tile)
+	}
+}
@@ -0,0 +1,151 @@
+package hydrogen
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestTiles(t *testing.T) {
+	covered := make([]int, 8*8)
+	for _, tl := range tiles(8, 3) {
+		if tl.X1-tl.X0 > 3 || tl.Y1-tl.Y0 > 3 {
+			t.Errorf("tile %v larger than 3x3", tl)
+		}
+		for j := tl.Y0; j < tl.Y1; j++ {
+			for i := tl.X0; i < tl.X1; i++ {
+				covered[j*8+i]++
+			}
+		}
+	}
+	for p, cnt := range covered {
+		if cnt != 1 {
+			t.Errorf("pixel (%v,%v) covered %v times", p%8, p/8, cnt)
+		}
+	}
+}
+
+// Connects to the coordinator with the fingerprint of rd, takes the first tile, and replies with res, or drops the
+// connection if res is nil.
+func faultyWorker(t *testing.T, rd *renderer, addr string, res *tileResultMsg) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	enc, dec := gob.NewEncoder(conn), gob.NewDecoder(conn)
+	if err := enc.Encode(&helloMsg{Fingerprint: rd.cfg.fingerprint}); err != nil {
+		t.Fatal(err)
+	}
+	msg := &tileMsg{}
+	if err := dec.Decode(msg); err != nil {
+		t.Fatal(err)
+	}
+	if res != nil {
+		res.Tile = msg.Tile
+		if err := enc.Encode(res); err != nil {
+			t.Fatal(err)
+		}
+		// The coordinator disconnects after rejecting the result.
+		dec.Decode(msg)
+	}
+}
+
+// The frames assembled from the tiles of two workers on the loopback are identical to a local render, after the tiles
+// of a worker that drops its connection and of one that sends a malformed result are put back into the queue, and a
+// worker with a different config is rejected.
+func TestDistributedRender(t *testing.T) {
+	fields := map[string]interface{}{"tileSize": 3, "colorMode": "phase"}
+	rd, err := newRenderer(testConfig(t, fields), []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantEscalated, err := rd.render(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	type result struct {
+		frames    []*frame
+		escalated int
+		err       error
+	}
+	coordinated := make(chan result, 1)
+	go func() {
+		frames, escalated, err := serveTiles(context.Background(), rd, ln)
+		coordinated <- result{frames, escalated, err}
+	}()
+
+	faultyWorker(t, rd, addr, nil)
+	faultyWorker(t, rd, addr, &tileResultMsg{})
+	fields["exposure"] = 3
+	other, err := newRenderer(testConfig(t, fields), []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := work(context.Background(), other, addr); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("error %v, expecting the worker with a different config to be rejected", err)
+	}
+
+	worked := make(chan error, 2)
+	for w := 0; w < 2; w++ {
+		go func() {
+			wrd, err := newRenderer(rd.cfg, []float64{0})
+			if err == nil {
+				err = work(context.Background(), wrd, addr)
+			}
+			worked <- err
+		}()
+	}
+	for w := 0; w < 2; w++ {
+		if err := <-worked; err != nil {
+			t.Errorf("worker failed: %v", err)
+		}
+	}
+	res := <-coordinated
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.escalated != wantEscalated {
+		t.Errorf("%v escalated pixels, want %v", res.escalated, wantEscalated)
+	}
+	for p := range want[0].data {
+		got, exp := res.frames[0], want[0]
+		if got.data[p].Cmp(exp.data[p]) != 0 || got.amps[p].re.Cmp(exp.amps[p].re) != 0 ||
+			got.amps[p].im.Cmp(exp.amps[p].im) != 0 {
+			t.Fatalf("pixel (%v,%v) differs from the local render", p%rd.cfg.ImageSize, p/rd.cfg.ImageSize)
+		}
+	}
+}
+
+// A worker losing the coordinator before it is told that all tiles are done fails.
+func TestWorkerLostCoordinator(t *testing.T) {
+	rd, err := newRenderer(testConfig(t, nil), []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		gob.NewDecoder(conn).Decode(&helloMsg{})
+		conn.Close()
+	}()
+	if err := work(context.Background(), rd, ln.Addr().String()); err == nil {
+		t.Error("worker succeeded without the coordinator")
+	}
+}
@@ -0,0 +1,428 @@
+package hydrogen
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/ALTree/bigfloat"
+	"github.com/euphoricrhino/sakurai-go/util"
+)
+
+// Represents a polynomial.
+type polynomial struct {
+	coeff []*big.Float
+}
+
+// Evaluates the polynomial at x, all powers are computed in logarithmic time.
+func (poly *polynomial) eval(x *big.Float) *big.Float {
+	pEval := newPowerEvaluator(x, len(poly.coeff)-1)
+	ans := blankFloat(x.Prec())
+	for k := 0; k < len(poly.coeff); k++ {
+		if poly.coeff[k] != nil {
+			ans.Add(ans, blankFloat(x.Prec()).Mul(poly.coeff[k], pEval.pow(k)))
+		}
+	}
+	return ans
+}
+
+// Evaluates wavefunction value for a given point.
+type evaluator struct {
+	terms []*termEvaluator
+	// Distinct principal quantum numbers among the terms, the exponential factor is computed once per n.
+	ns []int
+	// Inverse of the Bohr radius Z mu/a_0 of the ion, or the Bohr radius in momentum space, the coordinates are scaled
+	// by it before evaluating the hydrogen wavefunction.
+	scale *big.Float
+	// Whether the coordinates are momenta and the terms evaluate the momentum-space wavefunction.
+	momentum bool
+	// Energy unit Z^2 mu in hartree.
+	energy float64
+	// Precision of the big.Float arithmetic in bits.
+	prec uint
+}
+
+// Evaluates a single (n,l,m) term of the wavefunction.
+type termEvaluator struct {
+	n, l, m int
+	// Whether this term is the real orbital rather than Y_l^m.
+	real bool
+	// Polynomial part of the radial wavefunction, this is the product of r^l and F(a,c,2r/na_0).
+	// radPoly multiplied by e^{-r/na_0} will be the unnormalized radial wavefunction.
+	// In momentum space, this is the Gegenbauer polynomial C_{n-l-1}^{l+1} of x=(u^2-1)/(u^2+1) with u=np a_0/hbar,
+	// which multiplied by u^l/(u^2+1)^{l+2} will be the unnormalized radial wavefunction.
+	radPoly *polynomial
+	// Polynomial part of the angular wavefunction.
+	// angularPoly multiplied by sin(theta)^|m| will be P_l^|m|(cos(theta)).
+	angularPoly *polynomial
+	// Amplitude of the term in the superposition, times the radial and angular normalization constants.
+	coeff complexFloat
+}
+
+// Creates new wavefunction evaluator for the superposition of (n,l,m) states.
+func newEvaluator(cfg *Config) *evaluator {
+	// Normalize the amplitudes so that the state has unit norm, all (n,l,m) states being orthonormal.
+	prec := cfg.FloatPrec
+	norm := blankFloat(prec)
+	for _, t := range cfg.Terms {
+		norm.Add(norm, newFromFloat64(prec, t.Re*t.Re+t.Im*t.Im))
+	}
+	norm.Sqrt(norm)
+
+	// With the Bohr radius a=a_0/(Z mu), the wavefunction is a^{-3/2} times that of hydrogen at r/a, and the
+	// momentum-space wavefunction is a^{3/2} times that of hydrogen at pa.
+	eval := &evaluator{
+		scale:    blankFloat(prec).Mul(newFromInt(prec, cfg.Z), newFromFloat64(prec, cfg.ReducedMass)),
+		momentum: cfg.Space == momentumSpace,
+		energy:   float64(cfg.Z*cfg.Z) * cfg.ReducedMass,
+		prec:     prec,
+	}
+	if eval.momentum {
+		eval.scale.Quo(newFromInt(prec, 1), eval.scale)
+	}
+	volume := blankFloat(prec).Sqrt(eval.scale)
+	volume.Mul(volume, eval.scale)
+	norm.Quo(norm, volume)
+	seen := make(map[int]bool)
+	for _, t := range cfg.Terms {
+		n, l, m := t.N, t.L, t.M
+		isReal := cfg.Orbitals == realOrbitals
+		absM := m
+		if m < 0 {
+			absM = -m
+		}
+		an := angularNorm(prec, l, absM)
+		// Y_l^{-|m|} is (-1)^m times the conjugate of Y_l^|m|, which cancels the Condon-Shortley phase. The real
+		// orbitals also drop the phase, so that e.g., p_x is positive along the x-axis.
+		if m < 0 || (isReal && m != 0) {
+			an.Abs(an)
+		}
+		if isReal && m != 0 {
+			an.Mul(an, blankFloat(prec).Sqrt(newFromInt(prec, 2)))
+		}
+		coeff := newComplex(newFromFloat64(prec, t.Re), newFromFloat64(prec, t.Im))
+		rn, rp := radialNorm(prec, n, l), radialPoly(prec, n, l)
+		if eval.momentum {
+			rn, rp = momentumNorm(prec, n, l), gegenbauer(prec, n-l-1, l+1)
+			// The plane wave expansion of e^{-ip.r} contributes (-i)^l.
+			ph := [4][2]int{{1, 0}, {0, -1}, {-1, 0}, {0, 1}}[l%4]
+			coeff.mul(coeff, newComplex(newFromInt(prec, ph[0]), newFromInt(prec, ph[1])))
+		}
+		c := blankFloat(prec).Quo(rn, norm)
+		c.Mul(c, an)
+		coeff.scale(coeff, c)
+		eval.terms = append(eval.terms, &termEvaluator{
+			n:           n,
+			l:           l,
+			m:           m,
+			real:        isReal,
+			radPoly:     rp,
+			angularPoly: angular(prec, l, absM),
+			coeff:       coeff,
+		})
+		if !seen[n] {
+			seen[n] = true
+			eval.ns = append(eval.ns, n)
+		}
+	}
+	return eval
+}
+
+// Calculates the complex wavefunction amplitude for the given point (x,y,z).
+func (eval *evaluator) amplitude(x, y, z *big.Float) complexFloat {
+	psi := blankComplex(eval.prec)
+	for _, c := range eval.components(x, y, z) {
+		psi.add(psi, c)
+	}
+	return psi
+}
+
+// Calculates the wavefunction amplitude for the given point (x,y,z) split by energy, i.e., the k-th component is the
+// sum of all terms with principal quantum number ns[k]. In momentum space, (x,y,z) is the momentum.
+func (eval *evaluator) components(x, y, z *big.Float) []complexFloat {
+	prec := eval.prec
+	x = blankFloat(prec).Mul(x, eval.scale)
+	y = blankFloat(prec).Mul(y, eval.scale)
+	z = blankFloat(prec).Mul(z, eval.scale)
+	// Radial distance in units of the Bohr radius of the ion, or momentum in units of hbar over it.
+	r := blankFloat(prec).Mul(x, x)
+	r.Add(r, blankFloat(prec).Mul(y, y))
+	r.Add(r, blankFloat(prec).Mul(z, z))
+	r.Sqrt(r)
+
+	// cos(theta), and sin(theta)e^{i phi} which is (x+iy)/r.
+	ct := newFromFloat64(prec, 1.0)
+	sp := blankComplex(prec)
+	if r.Sign() != 0 {
+		ct.Quo(z, r)
+		sp = newComplex(blankFloat(prec).Quo(x, r), blankFloat(prec).Quo(y, r))
+	}
+
+	comps := make([]complexFloat, len(eval.ns))
+	for k, n := range eval.ns {
+		comps[k] = blankComplex(prec)
+		// e^{-r/na_0} is shared by all terms with the same n, and so are u=np a_0/hbar, 1/(u^2+1) and x in momentum
+		// space.
+		var exp, u, inv, x *big.Float
+		if eval.momentum {
+			u = blankFloat(prec).Mul(r, newFromInt(prec, n))
+			u2 := blankFloat(prec).Mul(u, u)
+			inv = blankFloat(prec).Quo(newFromInt(prec, 1), blankFloat(prec).Add(u2, newFromInt(prec, 1)))
+			x = blankFloat(prec).Sub(u2, newFromInt(prec, 1))
+			x.Mul(x, inv)
+		} else {
+			exp = bigfloat.Exp(blankFloat(prec).Quo(r, newFromInt(prec, -n)))
+		}
+		for _, t := range eval.terms {
+			if t.n != n {
+				continue
+			}
+			var rad *big.Float
+			if eval.momentum {
+				rad = t.radPoly.eval(x)
+				rad.Mul(rad, newPowerEvaluator(u, t.l).pow(t.l))
+				rad.Mul(rad, newPowerEvaluator(inv, t.l+2).pow(t.l+2))
+			} else {
+				rad = t.radPoly.eval(r)
+				rad.Mul(rad, exp)
+			}
+			rad.Mul(rad, t.angularPoly.eval(ct))
+			ang := t.phase(sp)
+			ang.mul(ang, t.coeff)
+			comps[k].add(comps[k], ang.scale(ang, rad))
+		}
+	}
+	return comps
+}
+
+// Combines the components returned by components() into the wavefunction amplitude at time t, given the phases
+// returned by phasesAt(t).
+func (eval *evaluator) evolve(comps, phases []complexFloat) complexFloat {
+	psi := blankComplex(eval.prec)
+	for k := range comps {
+		psi.add(psi, blankComplex(eval.prec).mul(comps[k], phases[k]))
+	}
+	return psi
+}
+
+// Calculates the phase factors e^{-iE_n t} for each of ns, where E_n=-Z^2 mu/2n^2 in atomic units.
+func (eval *evaluator) phasesAt(t float64) []complexFloat {
+	phases := make([]complexFloat, len(eval.ns))
+	for k, n := range eval.ns {
+		// The phase only affects the interference pattern, so float64 accuracy is adequate.
+		et := eval.energy * t / float64(2*n*n)
+		phases[k] = newComplex(newFromFloat64(eval.prec, math.Cos(et)), newFromFloat64(eval.prec, math.Sin(et)))
+	}
+	return phases
+}
+
+// Calculates the azimuthal part sin(theta)^|m| times e^{im phi}, or times cos(m phi) or sin(|m| phi) for the real
+// orbitals, given sp=sin(theta)e^{i phi}.
+func (t *termEvaluator) phase(sp complexFloat) complexFloat {
+	if t.m >= 0 {
+		ang := sp.pow(t.m)
+		if t.real {
+			ang.im.SetFloat64(0)
+		}
+		return ang
+	}
+	ang := sp.pow(-t.m)
+	if t.real {
+		return newComplex(ang.im, blankFloat(sp.re.Prec()))
+	}
+	ang.im.Neg(ang.im)
+	return ang
+}
+
+// Calculates the probability density for the wavefunction for the given point (x,y,z).
+func (eval *evaluator) probDensity(x, y, z *big.Float) *big.Float {
+	return eval.amplitude(x, y, z).abs2()
+}
+
+// Computes the radial normalization constant 2^(l+1)/((2l+1)! n^(l+2)) sqrt((n+l)!/(n-l-1)!), see hydrogen-radial.
+func radialNorm(prec uint, n, l int) *big.Float {
+	num := util.Factorial(n + l)
+	num.Div(num, util.Factorial(n-l-1))
+	ans := blankFloat(prec).SetInt(num)
+	ans.Sqrt(ans)
+	ans.SetMantExp(ans, l+1)
+	ans.Quo(ans, blankFloat(prec).SetInt(util.Factorial(2*l+1)))
+	return ans.Quo(ans, newPowerEvaluator(newFromInt(prec, n), l+2).pow(l+2))
+}
+
+// Computes the angular normalization constant (-1)^m sqrt((2l+1)/4pi (l-m)!/(l+m)!), see spherical-harmonics.
+func angularNorm(prec uint, l, m int) *big.Float {
+	ans := blankFloat(prec).SetInt(util.Factorial(l - m))
+	ans.Mul(ans, newFromInt(prec, 2*l+1))
+	ans.Quo(ans, blankFloat(prec).SetInt(util.Factorial(l+m)))
+	ans.Quo(ans, blankFloat(prec).Mul(newFromInt(prec, 4), pi(prec)))
+	ans.Sqrt(ans)
+	if m%2 == 1 {
+		ans.Neg(ans)
+	}
+	return ans
+}
+
+// Computes the momentum-space radial normalization constant sqrt(2/pi (n-l-1)!/(n+l)!) n^2 2^(2l+2) l!, see Bethe and
+// Salpeter.
+func momentumNorm(prec uint, n, l int) *big.Float {
+	ans := blankFloat(prec).SetInt(util.Factorial(n - l - 1))
+	ans.Mul(ans, newFromInt(prec, 2))
+	ans.Quo(ans, blankFloat(prec).SetInt(util.Factorial(n+l)))
+	ans.Quo(ans, pi(prec))
+	ans.Sqrt(ans)
+	ans.Mul(ans, newFromInt(prec, n*n))
+	ans.SetMantExp(ans, 2*l+2)
+	return ans.Mul(ans, blankFloat(prec).SetInt(util.Factorial(l)))
+}
+
+// Constructs the radial polynomial.
+func radialPoly(prec uint, n, l int) *polynomial {
+	a := l + 1 - n
+	c := 2*l + 2
+	deg := -a
+	// radPoly is the product of r^l and F(a,c,2r/na_0).
+	radPoly := &polynomial{
+		coeff: make([]*big.Float, deg+l+1),
+	}
+	radPoly.coeff[l] = newFromFloat64(prec, 1.0)
+	for d := 1; d <= deg; d++ {
+		factor := newFromRat(prec, (a+d-1)*2, (c+d-1)*(n*d))
+		radPoly.coeff[d+l] = blankFloat(prec).Mul(radPoly.coeff[d+l-1], factor)
+	}
+	return radPoly
+}
+
+// Constructs the polynomial part of the angular function.
+func angular(prec uint, l, m int) *polynomial {
+	pl := legendre(prec, l)
+	poly := &polynomial{
+		coeff: make([]*big.Float, len(pl.coeff)-m),
+	}
+	for k := len(pl.coeff) - 1; k >= m; k -= 2 {
+		poly.coeff[k-m] = blankFloat(prec).Set(pl.coeff[k])
+		for j := 0; j < m; j++ {
+			poly.coeff[k-m].Mul(poly.coeff[k-m], newFromInt(prec, k-j))
+		}
+	}
+	return poly
+}
+
+// Constructs Legendre polynomial P_l recursively.
+func legendre(prec uint, l int) *polynomial {
+	if l == 0 {
+		return &polynomial{
+			coeff: []*big.Float{newFromFloat64(prec, 1.0)},
+		}
+	}
+	if l == 1 {
+		return &polynomial{
+			coeff: []*big.Float{nil, newFromFloat64(prec, 1.0)},
+		}
+	}
+
+	pprev := legendre(prec, 0)
+	prev := legendre(prec, 1)
+	for ll := 2; ll <= l; ll++ {
+		cur := &polynomial{
+			coeff: make([]*big.Float, ll+1),
+		}
+
+		factor1 := newFromRat(prec, 2*ll-1, ll)
+		factor2 := newFromRat(prec, ll-1, ll)
+		// P_l only has powers with the same parity as l.
+		for k := ll; k >= 0; k -= 2 {
+			cur.coeff[k] = blankFloat(prec)
+			if k > 0 {
+				cur.coeff[k].Mul(prev.coeff[k-1], factor1)
+			}
+			if k <= ll-2 {
+				cur.coeff[k].Sub(cur.coeff[k], blankFloat(prec).Mul(pprev.coeff[k], factor2))
+			}
+		}
+		pprev = prev
+		prev = cur
+	}
+	return prev
+}
+
+// Constructs Gegenbauer polynomial C_k^alpha recursively.
+func gegenbauer(prec uint, k, alpha int) *polynomial {
+	if k == 0 {
+		return &polynomial{
+			coeff: []*big.Float{newFromFloat64(prec, 1.0)},
+		}
+	}
+	if k == 1 {
+		return &polynomial{
+			coeff: []*big.Float{nil, newFromInt(prec, 2*alpha)},
+		}
+	}
+
+	pprev := gegenbauer(prec, 0, alpha)
+	prev := gegenbauer(prec, 1, alpha)
+	for kk := 2; kk <= k; kk++ {
+		cur := &polynomial{
+			coeff: make([]*big.Float, kk+1),
+		}
+
+		factor1 := newFromRat(prec, 2*(kk+alpha-1), kk)
+		factor2 := newFromRat(prec, kk+2*alpha-2, kk)
+		// C_k^alpha only has powers with the same parity as k.
+		for j := kk; j >= 0; j -= 2 {
+			cur.coeff[j] = blankFloat(prec)
+			if j > 0 {
+				cur.coeff[j].Mul(prev.coeff[j-1], factor1)
+			}
+			if j <= kk-2 {
+				cur.coeff[j].Sub(cur.coeff[j], blankFloat(prec).Mul(pprev.coeff[j], factor2))
+			}
+		}
+		pprev = prev
+		prev = cur
+	}
+	return prev
+}
+
+// Evaluator for x raised to some power, after construction, all power evaluations can be run in logarithmic time.
+type powerEvaluator struct {
+	x *big.Float
+	// Precomputed all powers of form x^(2^n).
+	powers []*big.Float
+}
+
+// Constructs power evaluator given the maximum possible power to be computed subsequently.
+func newPowerEvaluator(x *big.Float, maxPower int) *powerEvaluator {
+	bits := 0
+	n := maxPower
+	for n != 0 {
+		n = n >> 1
+		bits++
+	}
+	pEval := &powerEvaluator{
+		x:      x,
+		powers: make([]*big.Float, bits+1),
+	}
+	// powers[0] was never explicitly used by pow() below, so let it remain nil.
+	if bits == 0 {
+		return pEval
+	}
+	pEval.powers[1] = blankFloat(x.Prec()).Set(x)
+	for k := 2; k <= bits; k++ {
+		pEval.powers[k] = blankFloat(x.Prec()).Mul(pEval.powers[k-1], pEval.powers[k-1])
+	}
+
+	return pEval
+}
+
+func (pEval *powerEvaluator) pow(n int) *big.Float {
+	ans := newFromFloat64(pEval.x.Prec(), 1.0)
+	shift := 1
+	for n != 0 {
+		if n&1 == 1 {
+			ans.Mul(ans, pEval.powers[shift])
+		}
+		shift++
+		n = n >> 1
+	}
+	return ans
+}
@@ -0,0 +1,156 @@
+package hydrogen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// (n,l) pairs of the normalization tests.
+var normStates = [][2]int{{1, 0}, {2, 0}, {2, 1}, {3, 2}, {5, 1}, {7, 4}, {10, 9}, {12, 3}}
+
+func TestRadialNorm(t *testing.T) {
+	testConfig(t, nil)
+	for _, s := range normStates {
+		n, l := s[0], s[1]
+		// The density decays as e^{-2r/n}, negligible beyond 40n+n^2.
+		if got := simpson(radialDensity(n, l), 0, float64(40*n+n*n), 20000); math.Abs(got-1) > 1e-9 {
+			t.Errorf("radial density of (%v,%v) integrates to %v", n, l, got)
+		}
+	}
+}
+
+func TestAngularNorm(t *testing.T) {
+	testConfig(t, nil)
+	for l := 0; l <= 8; l++ {
+		for m := 0; m <= l; m++ {
+			an, _ := angularNorm(testPrec, l, m).Float64()
+			poly := angular(testPrec, l, m)
+			// |Y_l^m|^2 integrated over phi, in theta rather than cos(theta) which has singular derivatives at the
+			// poles for odd m.
+			density := func(theta float64) float64 {
+				p, _ := poly.eval(newFromFloat64(testPrec, math.Cos(theta))).Float64()
+				p *= an * math.Pow(math.Sin(theta), float64(m))
+				return 2 * math.Pi * p * p * math.Sin(theta)
+			}
+			if got := simpson(density, 0, math.Pi, 2000); math.Abs(got-1) > 1e-9 {
+				t.Errorf("|Y_%v^%v|^2 integrates to %v", l, m, got)
+			}
+		}
+	}
+}
+
+// The amplitudes of the config are normalized, and the terms are orthonormal, so that the state has unit norm.
+func TestStateNorm(t *testing.T) {
+	for _, orbitals := range []string{complexOrbitals, realOrbitals} {
+		cfg := testConfig(t, map[string]interface{}{"n": nil, "l": nil, "m": nil, "orbitals": orbitals, "terms": []Term{
+			{N: 2, L: 1, M: 1, Re: 3}, {N: 3, L: 2, M: -1, Im: 4}, {N: 3, L: 0, M: 0, Re: 1, Im: 1},
+		}})
+		fe := newFastEvaluator(newEvaluator(cfg))
+		// |psi|^2 in spherical coordinates, by Simpson's rule in r and theta, and the mean over phi which is exact for
+		// trigonometric polynomials of low degree.
+		const nr, nt, np = 300, 60, 16
+		const rmax = 60.0
+		density := func(r, theta float64) float64 {
+			sum := 0.0
+			for k := 0; k < np; k++ {
+				phi := 2 * math.Pi * float64(k) / np
+				x, y, z := r*math.Sin(theta)*math.Cos(phi), r*math.Sin(theta)*math.Sin(phi), r*math.Cos(theta)
+				// float64 is accurate enough for the integral, even where it would escalate.
+				comps, _ := fe.components(x, y, z)
+				psi := blankComplex(testPrec)
+				for _, c := range comps {
+					psi.add(psi, c)
+				}
+				d, _ := psi.abs2().Float64()
+				sum += d
+			}
+			return 2 * math.Pi * sum / np * r * r * math.Sin(theta)
+		}
+		got := simpson(func(r float64) float64 {
+			return simpson(func(theta float64) float64 { return density(r, theta) }, 0, math.Pi, nt)
+		}, 0, rmax, nr)
+		if math.Abs(got-1) > 1e-6 {
+			t.Errorf("|psi|^2 of the %v orbitals integrates to %v", orbitals, got)
+		}
+	}
+}
+
+// The real orbitals of real amplitudes are real, and are sqrt(2)(-1)^m times the real part of Y_l^m for m>0, or the
+// imaginary part of Y_l^|m| for m<0.
+func TestRealOrbitals(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for l := 0; l <= 4; l++ {
+		for m := -l; m <= l; m++ {
+			t.Run(fmt.Sprintf("%v-%v", l, m), func(t *testing.T) {
+				absM := m
+				if absM < 0 {
+					absM = -absM
+				}
+				realEval := newEvaluator(testConfig(t, map[string]interface{}{
+					"n": l + 2, "l": l, "m": m, "orbitals": realOrbitals,
+				}))
+				complexEval := newEvaluator(testConfig(t, map[string]interface{}{"n": l + 2, "l": l, "m": absM}))
+				for p := 0; p < 20; p++ {
+					x := newFromFloat64(testPrec, 10*rng.Float64()-5)
+					y := newFromFloat64(testPrec, 10*rng.Float64()-5)
+					z := newFromFloat64(testPrec, 10*rng.Float64()-5)
+					psi := realEval.amplitude(x, y, z)
+					if psi.im.Sign() != 0 {
+						t.Fatalf("imaginary part %v", psi.im)
+					}
+					ylm := complexEval.amplitude(x, y, z)
+					want := blankFloat(testPrec).Set(ylm.re)
+					if m < 0 {
+						want.Set(ylm.im)
+					}
+					if m != 0 {
+						want.Mul(want, blankFloat(testPrec).Sqrt(newFromInt(testPrec, 2)))
+					}
+					if absM%2 == 1 {
+						want.Neg(want)
+					}
+					diff, _ := blankFloat(testPrec).Sub(psi.re, want).Float64()
+					scale, _ := blankFloat(testPrec).Abs(want).Float64()
+					if math.Abs(diff) > 1e-20*scale {
+						t.Fatalf("amplitude %v, expecting %v", psi.re, want)
+					}
+				}
+			})
+		}
+	}
+	// p_x, p_y and p_z are positive along their axes.
+	for m, axis := range map[int][3]float64{1: {1, 0, 0}, -1: {0, 1, 0}, 0: {0, 0, 1}} {
+		eval := newEvaluator(testConfig(t, map[string]interface{}{"n": 2, "l": 1, "m": m, "orbitals": realOrbitals}))
+		psi := eval.amplitude(newFromFloat64(testPrec, axis[0]), newFromFloat64(testPrec, axis[1]),
+			newFromFloat64(testPrec, axis[2]))
+		if psi.re.Sign() <= 0 {
+			t.Errorf("p orbital with m=%v is %v along %v", m, psi.re, axis)
+		}
+	}
+}
+
+func TestMomentumNorm(t *testing.T) {
+	testConfig(t, nil)
+	for _, s := range normStates {
+		n, l := s[0], s[1]
+		mn, _ := momentumNorm(testPrec, n, l).Float64()
+		poly := gegenbauer(testPrec, n-l-1, l+1)
+		// p^2 F_nl(p)^2 with p=tan(a)/n, which maps the slowly decaying tail to a finite interval.
+		density := func(a float64) float64 {
+			if a >= math.Pi/2 {
+				return 0
+			}
+			u := math.Tan(a)
+			inv := 1 / (u*u + 1)
+			g, _ := poly.eval(newFromFloat64(testPrec, (u*u-1)*inv)).Float64()
+			f := mn * g * math.Pow(u, float64(l)) * math.Pow(inv, float64(l+2))
+			p := u / float64(n)
+			return p * p * f * f / (float64(n) * math.Cos(a) * math.Cos(a))
+		}
+		if got := simpson(density, 0, math.Pi/2, 20000); math.Abs(got-1) > 1e-9 {
+			t.Errorf("momentum density of (%v,%v) integrates to %v", n, l, got)
+		}
+	}
+}
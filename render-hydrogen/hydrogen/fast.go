@@ -0,0 +1,240 @@
+package hydrogen
+
+import (
+	"math"
+	"math/big"
+)
+
+// Relative accuracy required from the float64 evaluation, the point is re-evaluated with big.Float otherwise.
+// Colors are looked up from a heatmap of at most a few thousand entries, so this is far more than enough.
+const escalationTolerance = 1e-6
+
+// Float64 mantissa with a separate binary exponent, so that the range is practically unbounded while keeping float64
+// precision, e.g., the radial polynomial coefficients of large n easily underflow float64.
+type scaled struct {
+	// Either 0, or 0.5<=|mant|<1.
+	mant float64
+	exp  int
+}
+
+func newScaled(x float64) scaled {
+	m, e := math.Frexp(x)
+	return scaled{mant: m, exp: e}
+}
+
+func scaledFromBig(x *big.Float) scaled {
+	if x == nil {
+		return scaled{}
+	}
+	mant := new(big.Float)
+	e := x.MantExp(mant)
+	m, _ := mant.Float64()
+	return scaled{mant: m, exp: e}
+}
+
+func (a scaled) toBig(prec uint) *big.Float {
+	return blankFloat(prec).SetMantExp(newFromFloat64(prec, a.mant), a.exp)
+}
+
+func (a scaled) float64() float64 {
+	return math.Ldexp(a.mant, a.exp)
+}
+
+func (a scaled) mul(b scaled) scaled {
+	m, e := math.Frexp(a.mant * b.mant)
+	return scaled{mant: m, exp: e + a.exp + b.exp}
+}
+
+func (a scaled) add(b scaled) scaled {
+	if a.mant == 0 {
+		return b
+	}
+	if b.mant == 0 {
+		return a
+	}
+	if a.exp < b.exp {
+		a, b = b, a
+	}
+	m, e := math.Frexp(a.mant + math.Ldexp(b.mant, b.exp-a.exp))
+	return scaled{mant: m, exp: e + a.exp}
+}
+
+func (a scaled) abs() scaled {
+	return scaled{mant: math.Abs(a.mant), exp: a.exp}
+}
+
+// Reports whether a<b, both a and b must be non-negative.
+func (a scaled) less(b scaled) bool {
+	if a.mant == 0 || b.mant == 0 {
+		return b.mant != 0
+	}
+	if a.exp != b.exp {
+		return a.exp < b.exp
+	}
+	return a.mant < b.mant
+}
+
+// Returns a^n for non-negative n.
+func (a scaled) pow(n int) scaled {
+	ans := newScaled(1.0)
+	for n != 0 {
+		if n&1 == 1 {
+			ans = ans.mul(a)
+		}
+		n = n >> 1
+		a = a.mul(a)
+	}
+	return ans
+}
+
+// Returns e^{-x} for x>=0.
+func scaledExpNeg(x float64) scaled {
+	// e^{-x}=2^{-k}e^{-(x-k ln2)}.
+	k := math.Floor(x / math.Ln2)
+	ans := newScaled(math.Exp(-(x - k*math.Ln2)))
+	ans.exp -= int(k)
+	return ans
+}
+
+// Evaluates the polynomial at x with Horner's method, also returns the sum of the absolute values of all terms,
+// which bounds the rounding error.
+func hornerScaled(coeff []scaled, x float64) (scaled, scaled) {
+	sx, ax := newScaled(x), newScaled(math.Abs(x))
+	val, abs := scaled{}, scaled{}
+	for k := len(coeff) - 1; k >= 0; k-- {
+		val = val.mul(sx).add(coeff[k])
+		abs = abs.mul(ax).add(coeff[k].abs())
+	}
+	return val, abs
+}
+
+// Evaluates the wavefunction in float64 arithmetic, detecting when the result is not accurate enough.
+type fastEvaluator struct {
+	ns    []int
+	terms []*fastTerm
+	// Same as evaluator.scale and evaluator.momentum.
+	scale    float64
+	momentum bool
+	// Precision of the big.Float results, same as evaluator.prec.
+	prec uint
+}
+
+// Float64 counterpart of termEvaluator.
+type fastTerm struct {
+	n, l, m  int
+	real     bool
+	radCoeff []scaled
+	angCoeff []scaled
+	// Real and imaginary part of termEvaluator.coeff, and its absolute value.
+	coeffRe, coeffIm, coeffAbs scaled
+	// Number of floating point operations involved, for the rounding error bound.
+	ops int
+}
+
+// Creates the float64 evaluator sharing the coefficients of the big.Float evaluator.
+func newFastEvaluator(eval *evaluator) *fastEvaluator {
+	fe := &fastEvaluator{ns: eval.ns, momentum: eval.momentum, prec: eval.prec}
+	fe.scale, _ = eval.scale.Float64()
+	for _, t := range eval.terms {
+		ft := &fastTerm{
+			n:        t.n,
+			l:        t.l,
+			m:        t.m,
+			real:     t.real,
+			radCoeff: make([]scaled, len(t.radPoly.coeff)),
+			angCoeff: make([]scaled, len(t.angularPoly.coeff)),
+			coeffRe:  scaledFromBig(t.coeff.re),
+			coeffIm:  scaledFromBig(t.coeff.im),
+			coeffAbs: scaledFromBig(new(big.Float).Sqrt(t.coeff.abs2())),
+		}
+		for k, c := range t.radPoly.coeff {
+			ft.radCoeff[k] = scaledFromBig(c)
+		}
+		for k, c := range t.angularPoly.coeff {
+			ft.angCoeff[k] = scaledFromBig(c)
+		}
+		absM := t.m
+		if absM < 0 {
+			absM = -absM
+		}
+		ft.ops = 2*(len(ft.radCoeff)+len(ft.angCoeff)) + 2*bitLen(absM) + 16
+		if eval.momentum {
+			// The rounding of x propagates through the polynomial, plus the powers of u and 1/(u^2+1).
+			ft.ops += len(ft.radCoeff) + 2*bitLen(t.l) + 2*bitLen(t.l+2) + 8
+		}
+		fe.terms = append(fe.terms, ft)
+	}
+	return fe
+}
+
+// Same as evaluator.components() but in float64 arithmetic. Returns false if the rounding error may exceed
+// escalationTolerance relative to the magnitude of the result, in which case the caller must fall back to big.Float.
+func (fe *fastEvaluator) components(x, y, z float64) ([]complexFloat, bool) {
+	x, y, z = x*fe.scale, y*fe.scale, z*fe.scale
+	r := math.Sqrt(x*x + y*y + z*z)
+	rho := math.Sqrt(x*x + y*y)
+	// cos(theta), sin(theta) and phi.
+	ct, st, phi := 1.0, 0.0, math.Atan2(y, x)
+	if r != 0 {
+		ct, st = z/r, rho/r
+	}
+
+	comps := make([]complexFloat, len(fe.ns))
+	errBound, total := scaled{}, scaled{}
+	for k, n := range fe.ns {
+		// The argument of the radial polynomial, and e^{-r/na_0}, or u=np a_0/hbar and 1/(u^2+1) in momentum space.
+		arg, exp, u, inv := r, scaled{}, 0.0, 0.0
+		if fe.momentum {
+			u = r * float64(n)
+			inv = 1 / (u*u + 1)
+			arg = (u*u - 1) * inv
+		} else {
+			exp = scaledExpNeg(r / float64(n))
+		}
+		re, im := scaled{}, scaled{}
+		for _, t := range fe.terms {
+			if t.n != n {
+				continue
+			}
+			rad, radAbs := hornerScaled(t.radCoeff, arg)
+			ang, angAbs := hornerScaled(t.angCoeff, ct)
+			absM := t.m
+			if absM < 0 {
+				absM = -absM
+			}
+			// sin(theta)^|m|, times cos and sin of m phi.
+			decay := exp
+			if fe.momentum {
+				decay = newScaled(u).pow(t.l).mul(newScaled(inv).pow(t.l + 2))
+			}
+			mag := newScaled(st).pow(absM).mul(decay)
+			c, s := math.Cos(float64(t.m)*phi), math.Sin(float64(t.m)*phi)
+			if t.real {
+				if t.m >= 0 {
+					s = 0
+				} else {
+					c, s = math.Sin(float64(absM)*phi), 0
+				}
+			}
+			v := rad.mul(ang).mul(mag)
+			cs, ss := newScaled(c), newScaled(s)
+			re = re.add(v.mul(t.coeffRe.mul(cs).add(t.coeffIm.mul(ss).mul(newScaled(-1)))))
+			im = im.add(v.mul(t.coeffRe.mul(ss).add(t.coeffIm.mul(cs))))
+			bound := radAbs.mul(angAbs).mul(mag).mul(t.coeffAbs).mul(newScaled(float64(t.ops) * 0x1p-52))
+			errBound = errBound.add(bound)
+		}
+		comps[k] = complexFloat{re: re.toBig(fe.prec), im: im.toBig(fe.prec)}
+		total = total.add(re.abs()).add(im.abs())
+	}
+	return comps, !total.mul(newScaled(escalationTolerance)).less(errBound)
+}
+
+// Returns the number of binary digits of n.
+func bitLen(n int) int {
+	bits := 0
+	for n != 0 {
+		n = n >> 1
+		bits++
+	}
+	return bits
+}
@@ -0,0 +1,161 @@
+package hydrogen
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// Returns the sum of |re|+|im| of the components.
+func componentsMagnitude(comps []complexFloat) float64 {
+	total := blankFloat(testPrec)
+	for _, c := range comps {
+		total.Add(total, blankFloat(testPrec).Abs(c.re))
+		total.Add(total, blankFloat(testPrec).Abs(c.im))
+	}
+	ans, _ := total.Float64()
+	return ans
+}
+
+// Returns the sum of |re|+|im| of the differences of the components.
+func componentsDistance(a, b []complexFloat) float64 {
+	diff := make([]complexFloat, len(a))
+	for k := range a {
+		diff[k] = complexFloat{
+			re: blankFloat(testPrec).Sub(a[k].re, b[k].re),
+			im: blankFloat(testPrec).Sub(a[k].im, b[k].im),
+		}
+	}
+	return componentsMagnitude(diff)
+}
+
+func TestFastEvaluatorAgreement(t *testing.T) {
+	for _, s := range []struct {
+		name   string
+		fields map[string]interface{}
+		radius float64
+	}{
+		{"20-10-3", map[string]interface{}{"n": 20, "l": 10, "m": 3}, 1000},
+		{"30-25--5", map[string]interface{}{"n": 30, "l": 25, "m": -5}, 2000},
+		{"25-0-0", map[string]interface{}{"n": 25, "l": 0, "m": 0}, 1500},
+		{"18-12-7-real", map[string]interface{}{"n": 18, "l": 12, "m": 7, "orbitals": "real"}, 800},
+		{"superposition", map[string]interface{}{"n": nil, "l": nil, "m": nil, "terms": []Term{
+			{N: 15, L: 9, M: 2, Re: 1}, {N: 16, L: 14, M: -3, Im: 0.5}, {N: 15, L: 4, M: 0, Re: -0.3, Im: 0.2},
+		}}, 600},
+		{"12-7-2-momentum", map[string]interface{}{"n": 12, "l": 7, "m": 2, "space": "momentum"}, 0.5},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			cfg := testConfig(t, s.fields)
+			eval := newEvaluator(cfg)
+			fe := newFastEvaluator(eval)
+			rng := rand.New(rand.NewSource(1))
+			fast := 0
+			const points = 400
+			for p := 0; p < points; p++ {
+				x := s.radius * (2*rng.Float64() - 1)
+				y := s.radius * (2*rng.Float64() - 1)
+				z := s.radius * (2*rng.Float64() - 1)
+				comps, ok := fe.components(x, y, z)
+				if !ok {
+					continue
+				}
+				fast++
+				want := eval.components(
+					newFromFloat64(testPrec, x), newFromFloat64(testPrec, y), newFromFloat64(testPrec, z))
+				if d, m := componentsDistance(comps, want), componentsMagnitude(want); d > escalationTolerance*m {
+					t.Errorf("fast components at (%v,%v,%v) differ by %v relative to %v", x, y, z, d, m)
+				}
+			}
+			// Most points don't escalate, or the check above is vacuous.
+			if fast < points/2 {
+				t.Errorf("only %v of %v points evaluated in float64", fast, points)
+			}
+		})
+	}
+}
+
+func TestFastEvaluatorEscalatesAtNodes(t *testing.T) {
+	// Finds the root of f in [lo,hi], where f changes sign, to the float64 precision.
+	root := func(f func(float64) *big.Float, lo, hi float64) float64 {
+		slo := f(lo).Sign()
+		for {
+			mid := (lo + hi) / 2
+			if mid <= lo || mid >= hi {
+				return mid
+			}
+			if f(mid).Sign() == slo {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+	}
+
+	t.Run("radial", func(t *testing.T) {
+		const n, l = 12, 3
+		cfg := testConfig(t, map[string]interface{}{"n": n, "l": l, "m": 1})
+		eval := newEvaluator(cfg)
+		fe := newFastEvaluator(eval)
+		poly := radialPoly(testPrec, n, l)
+		rad := func(r float64) *big.Float { return poly.eval(newFromFloat64(testPrec, r)) }
+		// The radial nodes of the polynomial part are between 0.01 and 4n^2, scan for the sign changes.
+		nodes := 0
+		for r := 0.01; r < 4*n*n; r += 0.01 {
+			if rad(r).Sign() == rad(r+0.01).Sign() {
+				continue
+			}
+			node := root(rad, r, r+0.01)
+			nodes++
+			// A direction off the angular nodes.
+			x, y, z := node*0.48, node*0.6, node*0.64
+			if _, ok := fe.components(x, y, z); ok {
+				t.Errorf("no escalation at the radial node r=%v", node)
+			}
+		}
+		if nodes != n-l-1 {
+			t.Fatalf("found %v radial nodes, expecting %v", nodes, n-l-1)
+		}
+	})
+
+	t.Run("angular", func(t *testing.T) {
+		const n, l = 10, 6
+		cfg := testConfig(t, map[string]interface{}{"n": n, "l": l, "m": 0})
+		eval := newEvaluator(cfg)
+		fe := newFastEvaluator(eval)
+		poly := angular(testPrec, l, 0)
+		ang := func(ct float64) *big.Float { return poly.eval(newFromFloat64(testPrec, ct)) }
+		nodes := 0
+		for ct := -0.999; ct < 0.999; ct += 0.001 {
+			if ang(ct).Sign() == ang(ct+0.001).Sign() {
+				continue
+			}
+			node := root(ang, ct, ct+0.001)
+			nodes++
+			// The nodal cone at a few radii, the point is rounded to float64 but stays within rounding of the cone.
+			for _, r := range []float64{5, 50, 200} {
+				st := math.Sqrt(1 - node*node)
+				x, y, z := r*st*math.Cos(1), r*st*math.Sin(1), r*node
+				if _, ok := fe.components(x, y, z); ok {
+					t.Errorf("no escalation on the nodal cone cos(theta)=%v at r=%v", node, r)
+				}
+			}
+		}
+		if nodes != l {
+			t.Fatalf("found %v angular nodes, expecting %v", nodes, l)
+		}
+	})
+
+	// The sign of a nodal plane is exact in float64, with no escalation needed as both the value and the bound vanish.
+	t.Run("plane", func(t *testing.T) {
+		cfg := testConfig(t, map[string]interface{}{"n": 5, "l": 1, "m": 0})
+		fe := newFastEvaluator(newEvaluator(cfg))
+		comps, ok := fe.components(3, 4, 0)
+		if !ok {
+			t.Fatal("escalation in the nodal plane z=0")
+		}
+		if m := componentsMagnitude(comps); m != 0 {
+			t.Errorf("components in the nodal plane z=0 are %v", m)
+		}
+	})
+}
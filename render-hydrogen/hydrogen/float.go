@@ -0,0 +1,41 @@
+package hydrogen
+
+import (
+	"math/big"
+)
+
+// The big.Float helpers take the precision of the computation in bits, i.e., floatPrec of the config.
+
+func blankFloat(prec uint) *big.Float { return big.NewFloat(0).SetPrec(prec) }
+
+func newFromFloat64(prec uint, val float64) *big.Float {
+	return big.NewFloat(val).SetPrec(prec)
+}
+
+func newFromInt(prec uint, val int) *big.Float {
+	return blankFloat(prec).SetInt64(int64(val))
+}
+
+func newFromRat(prec uint, n, d int) *big.Float {
+	return blankFloat(prec).SetRat(big.NewRat(int64(n), int64(d)))
+}
+
+// Computes pi to prec bits with the Gauss-Legendre algorithm, which doubles the correct digits every iteration.
+func pi(prec uint) *big.Float {
+	a := newFromFloat64(prec, 1.0)
+	b := blankFloat(prec).Sqrt(newFromRat(prec, 1, 2))
+	t := newFromRat(prec, 1, 4)
+	p := newFromFloat64(prec, 1.0)
+	for bits := uint(1); bits < 2*prec; bits *= 2 {
+		an := blankFloat(prec).Add(a, b)
+		an.Quo(an, newFromInt(prec, 2))
+		b.Sqrt(blankFloat(prec).Mul(a, b))
+		d := blankFloat(prec).Sub(a, an)
+		t.Sub(t, blankFloat(prec).Mul(p, blankFloat(prec).Mul(d, d)))
+		p.Mul(p, newFromInt(prec, 2))
+		a = an
+	}
+	ans := blankFloat(prec).Add(a, b)
+	ans.Mul(ans, ans)
+	return ans.Quo(ans, blankFloat(prec).Mul(t, newFromInt(prec, 4)))
+}
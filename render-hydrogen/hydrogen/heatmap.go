@@ -0,0 +1,130 @@
+package hydrogen
+
+import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+// Number of entries of the heatmaps built from control points.
+const heatmapSize = 1024
+
+// Evenly spaced control points of the built-in heatmaps. The sequential ones are 10 colors of the matplotlib colormaps
+// of the same names, which the linear interpolation between them only approximates, and coolwarm is Moreland's
+// diverging colormap, meant for signed data.
+var builtinHeatmaps = map[string][]string{
+	"viridis": {
+		"#440154", "#482878", "#3e4989", "#31688e", "#26828e",
+		"#1f9e89", "#35b779", "#6ece58", "#b5de2b", "#fde725",
+	},
+	"magma": {
+		"#000004", "#180f3d", "#440f76", "#721f81", "#9e2f7f",
+		"#cd4071", "#f1605d", "#fd9668", "#feca8d", "#fcfdbf",
+	},
+	"inferno": {
+		"#000004", "#1b0c41", "#4a0c6b", "#781c6d", "#a52c60",
+		"#cf4446", "#ed6925", "#fb9b06", "#f7d13d", "#fcffa4",
+	},
+	"cividis": {
+		"#00224e", "#123570", "#3b496c", "#575d6d", "#707173",
+		"#8a8678", "#a59c74", "#c3b369", "#e1cc55", "#fee838",
+	},
+	"coolwarm": {
+		"#3b4cc0", "#6282ea", "#8db0fe", "#b8d0f9", "#dddddd",
+		"#f5c4ac", "#f49a7b", "#de604d", "#b40426",
+	},
+}
+
+// Control point of a custom gradient.
+type GradientStop struct {
+	// Position in [0,1] along the heatmap.
+	Pos float64 `json:"pos"`
+	// Color as "#rrggbb".
+	Color string `json:"color"`
+}
+
+// Loads the heatmap configured by heatmapFile, heatmap or gradient, reversed if configured.
+func (cfg *Config) loadHeatmap() error {
+	switch {
+	case cfg.HeatmapFile != "":
+		heatmap, err := readHeatmapFile(cfg.HeatmapFile)
+		if err != nil {
+			return fieldError("heatmapFile", fmt.Sprintf("invalid heatmapFile: %v", err))
+		}
+		cfg.heatmap = heatmap
+	case cfg.Heatmap != "":
+		hexes := builtinHeatmaps[cfg.Heatmap]
+		stops := make([]GradientStop, len(hexes))
+		for k, hex := range hexes {
+			stops[k] = GradientStop{Pos: float64(k) / float64(len(hexes)-1), Color: hex}
+		}
+		cfg.heatmap = gradientHeatmap(stops)
+	default:
+		cfg.heatmap = gradientHeatmap(cfg.Gradient)
+	}
+	if cfg.ReverseHeatmap {
+		for i, j := 0, len(cfg.heatmap)-1; i < j; i, j = i+1, j-1 {
+			cfg.heatmap[i], cfg.heatmap[j] = cfg.heatmap[j], cfg.heatmap[i]
+		}
+	}
+	return nil
+}
+
+// Reads the first row of the PNG file.
+func readHeatmapFile(filename string) ([]color.Color, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open heatmap file: %w", err)
+	}
+	defer f.Close()
+	hm, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode heatmap as PNG: %w", err)
+	}
+	rect := hm.Bounds()
+	width := rect.Max.X - rect.Min.X
+	heatmap := make([]color.Color, width)
+	for i := 0; i < width; i++ {
+		heatmap[i] = hm.At(i+rect.Min.X, rect.Min.Y)
+	}
+	return heatmap, nil
+}
+
+// Interpolates the validated control points linearly in RGB into heatmapSize entries, extending the first and last
+// colors to the ends.
+func gradientHeatmap(stops []GradientStop) []color.Color {
+	colors := make([]color.RGBA, len(stops))
+	for k, stop := range stops {
+		colors[k], _ = parseHexColor(stop.Color)
+	}
+	heatmap := make([]color.Color, heatmapSize)
+	k := 0
+	for i := range heatmap {
+		pos := float64(i) / float64(heatmapSize-1)
+		for k+1 < len(stops) && stops[k+1].Pos < pos {
+			k++
+		}
+		if pos <= stops[0].Pos || k+1 == len(stops) {
+			heatmap[i] = colors[k]
+			continue
+		}
+		t := (pos - stops[k].Pos) / (stops[k+1].Pos - stops[k].Pos)
+		lerp := func(a, b uint8) uint8 { return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5) }
+		a, b := colors[k], colors[k+1]
+		heatmap[i] = color.RGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: 0xff}
+	}
+	return heatmap
+}
+
+// Parses "#rrggbb".
+func parseHexColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 0xff}
+	if len(s) != 7 || s[0] != '#' {
+		return c, fmt.Errorf("invalid color %q", s)
+	}
+	if _, err := fmt.Sscanf(s[1:], "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("invalid color %q: %v", s, err)
+	}
+	return c, nil
+}
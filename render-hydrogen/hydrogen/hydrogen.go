@@ -0,0 +1,84 @@
+// Package hydrogen renders the probability density of hydrogen-like states in big.Float precision, see the README of
+// render-hydrogen for the config. The render-hydrogen command is a thin wrapper of ParseConfigFile and Run, while
+// Render embeds the renderer without writing any file.
+package hydrogen
+
+import (
+	"context"
+	"image"
+)
+
+// RawData is the density behind a rendered image, i.e., the data written by rawOutput, before normalization and the
+// heatmap.
+type RawData struct {
+	// Side length of the frames in pixels.
+	Size int
+	// Density of each frame with the layers composited, indexed by j*Size+i for pixel (i,j). The frames are the single
+	// view of the camera, the two eyes of a stereo pair, or the panels.
+	Density [][]float64
+	// Density of each layer of each frame, indexed by k*Size^2+j*Size+i with k counted from the nearest layer, only set
+	// with rawOutput.layers.
+	Layers [][]float64
+}
+
+// Render renders the still image of the config locally, refined and annotated as configured, and returns it with the
+// raw data behind it, without writing any file. The config is validated first, see Validate, and left unchanged. The
+// render stops with ctx.Err() once ctx is done. Configs with animation, turntable or sweep, which produce several
+// images, are rejected with a *ConfigError.
+func Render(ctx context.Context, cfg *Config) (image.Image, RawData, error) {
+	cfg, err := cfg.validated()
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	switch {
+	case cfg.Animation != nil:
+		return nil, RawData{}, fieldError("animation", "Render produces a single image, without animation")
+	case cfg.Turntable != nil:
+		return nil, RawData{}, fieldError("turntable", "Render produces a single image, without turntable")
+	case cfg.Sweep != nil:
+		return nil, RawData{}, fieldError("sweep", "Render produces a single image, without sweep")
+	}
+	rd, err := prepare(cfg, []float64{0})
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	if len(cfg.Panels) > 0 {
+		imgs, panelFrames, err := renderPanels(ctx, rd)
+		if err != nil {
+			return nil, RawData{}, err
+		}
+		frames := make([]*frame, len(panelFrames))
+		for k, fr := range panelFrames {
+			frames[k] = fr[0]
+		}
+		return imgs[0], rawData(cfg, frames), nil
+	}
+	frames, escalated, err := rd.render(ctx, nil)
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	imgs, err := rd.images(ctx, frames, escalated)
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	return imgs[0], rawData(cfg, frames), nil
+}
+
+// Derives the auto lengths and creates the renderer of the validated config for the given times.
+func prepare(cfg *Config, times []float64) (*renderer, error) {
+	if err := cfg.resolveAuto(); err != nil {
+		return nil, err
+	}
+	return newRenderer(cfg, times)
+}
+
+func rawData(cfg *Config, frames []*frame) RawData {
+	raw := RawData{Size: cfg.ImageSize}
+	for _, fr := range frames {
+		raw.Density = append(raw.Density, fr.density())
+		if fr.layers != nil {
+			raw.Layers = append(raw.Layers, fr.layers)
+		}
+	}
+	return raw
+}
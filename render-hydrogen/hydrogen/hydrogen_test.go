@@ -0,0 +1,104 @@
+package hydrogen
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Precision of the tests.
+const testPrec = 100
+
+// Returns the config file content of a small render of the 3d state with the given fields replaced, or removed if nil.
+func testConfigData(t *testing.T, fields map[string]interface{}) []byte {
+	t.Helper()
+	base := map[string]interface{}{
+		"cameraTheta": 60,
+		"cameraPhi":   30,
+		"imageSize":   8,
+		"fovSize":     30,
+		"layerDist":   3,
+		"layers":      5,
+		"concurrency": 4,
+		"floatPrec":   testPrec,
+		"heatmap":     "viridis",
+		"exposure":    2,
+		"outputFile":  filepath.Join(t.TempDir(), "out.png"),
+		"n":           3,
+		"l":           2,
+		"m":           1,
+	}
+	for k, v := range fields {
+		base[k] = v
+	}
+	data, err := json.Marshal(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Returns the validated config of testConfigData, with the auto lengths derived.
+func testConfig(t *testing.T, fields map[string]interface{}) *Config {
+	t.Helper()
+	parsed, err := ParseConfig(testConfigData(t, fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parsed.validated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolveAuto(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// Render leaves the config unchanged, so that the same Config renders the new state after changing n and l, at a
+// different precision.
+func TestRenderAgain(t *testing.T) {
+	cfg, err := ParseConfig(testConfigData(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, first, err := Render(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.N, cfg.L, cfg.FloatPrec = 2, 1, 2*testPrec
+	_, again, err := Render(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := ParseConfig(testConfigData(t, map[string]interface{}{"n": 2, "l": 1, "floatPrec": 2 * testPrec}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want, err := Render(context.Background(), fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Density, want.Density) {
+		t.Errorf("density of the changed config %v, expecting %v", again.Density, want.Density)
+	}
+	if reflect.DeepEqual(again.Density, first.Density) {
+		t.Error("density unchanged after changing n and l")
+	}
+}
+
+// Integrates f over [a,b] with Simpson's rule on steps (even) intervals.
+func simpson(f func(float64) float64, a, b float64, steps int) float64 {
+	h := (b - a) / float64(steps)
+	sum := f(a) + f(b)
+	for k := 1; k < steps; k++ {
+		w := 2.0
+		if k%2 == 1 {
+			w = 4
+		}
+		sum += w * f(a+float64(k)*h)
+	}
+	return sum * h / 3
+}
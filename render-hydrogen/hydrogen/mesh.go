@@ -0,0 +1,413 @@
+package hydrogen
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Evaluates the wavefunction of the first frame at (x,y,z), in float64 if accurate enough.
+func (rd *renderer) amplitude(x, y, z float64) complex128 {
+	var comps []complexFloat
+	ok := false
+	if rd.fe != nil {
+		comps, ok = rd.fe.components(x, y, z)
+	}
+	if !ok {
+		prec := rd.eval.prec
+		comps = rd.eval.components(newFromFloat64(prec, x), newFromFloat64(prec, y), newFromFloat64(prec, z))
+	}
+	psi := rd.eval.evolve(comps, rd.phases[0])
+	re, _ := psi.re.Float64()
+	im, _ := psi.im.Float64()
+	return complex(re, im)
+}
+
+// Triangle mesh with per-face sign of the wavefunction.
+type mesh struct {
+	vertices [][3]float64
+	// Real part of the wavefunction at each vertex.
+	vertexRe []float64
+	faces    [][3]int
+}
+
+// Whether the real part of the wavefunction is non-negative on the face.
+func (m *mesh) positive(f int) bool {
+	sum := 0.0
+	for _, v := range m.faces[f] {
+		sum += m.vertexRe[v]
+	}
+	return sum >= 0
+}
+
+// Samples the wavefunction on the cubic grid of the isosurface config, and extracts the surface enclosing the
+// configured fraction of the probability with marching cubes, then writes it in all configured formats. Stops with
+// ctx.Err() once ctx is done during the sampling.
+func exportMesh(ctx context.Context, rd *renderer) error {
+	iso := rd.cfg.Isosurface
+	n := iso.Resolution
+	step := 2 * iso.Extent / float64(n-1)
+	pos := func(idx int) float64 { return -iso.Extent + float64(idx)*step }
+
+	// Sample the grid, indexed by (z*n+y)*n+x.
+	psi := make([]complex128, n*n*n)
+	var wg, progressWg sync.WaitGroup
+	ch := showProgress(rd.cfg, n*n, &progressWg)
+	wg.Add(rd.cfg.Concurrency)
+	for w := 0; w < rd.cfg.Concurrency; w++ {
+		go func(shard int) {
+			defer wg.Done()
+			for zy := shard; zy < n*n; zy += rd.cfg.Concurrency {
+				if ctx.Err() != nil {
+					return
+				}
+				z, y := zy/n, zy%n
+				for x := 0; x < n; x++ {
+					psi[zy*n+x] = rd.amplitude(pos(x), pos(y), pos(z))
+				}
+				ch <- struct{}{}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ch)
+	progressWg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	density := make([]float64, len(psi))
+	for p, v := range psi {
+		density[p] = real(v)*real(v) + imag(v)*imag(v)
+	}
+	threshold := enclosingThreshold(density, iso.Enclosed)
+	m := marchingCubes(n, density, psi, threshold, pos)
+	rd.cfg.logf("isosurface at density %g enclosing %v of the sampled probability: %v vertices, %v faces\n",
+		threshold, iso.Enclosed, len(m.vertices), len(m.faces))
+
+	for _, format := range iso.Formats {
+		filename := iso.File + "." + format
+		out, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(out)
+		switch format {
+		case "obj":
+			err = m.writeOBJ(w, filename)
+		case "ply":
+			m.writePLY(w)
+		case "stl":
+			m.writeSTL(w)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the density threshold such that the grid points above it hold the given fraction of the total.
+func enclosingThreshold(density []float64, fraction float64) float64 {
+	sorted := append([]float64(nil), density...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	total := 0.0
+	for _, d := range sorted {
+		total += d
+	}
+	sum := 0.0
+	for _, d := range sorted {
+		sum += d
+		if sum >= fraction*total {
+			return d
+		}
+	}
+	return 0
+}
+
+// Corner c of the unit cube has offset (c&1, (c>>1)&1, (c>>2)&1).
+// The 4 corners of each cube face in cyclic order, the edges of the face connect consecutive corners.
+var cubeFaces = [6][4]int{
+	{0, 2, 6, 4}, {1, 3, 7, 5}, // x=0, x=1
+	{0, 1, 5, 4}, {2, 3, 7, 6}, // y=0, y=1
+	{0, 1, 3, 2}, {4, 5, 7, 6}, // z=0, z=1
+}
+
+// Extracts the surface density=threshold from the n^3 grid. Rather than the usual 256-case lookup table, each cube's
+// polygons are built by pairing the crossed edges on each face and chaining the pairs into loops. An ambiguous face
+// (diagonal corners inside) is resolved by the average of its corners, which depends on the face alone, so that the
+// two cubes sharing it agree and the surface is closed. The segments are directed, so that the surface is also
+// consistently oriented.
+func marchingCubes(n int, density []float64, psi []complex128, threshold float64, pos func(int) float64) *mesh {
+	step := pos(1) - pos(0)
+	m := &mesh{}
+	idx := func(x, y, z int) int { return (z*n+y)*n + x }
+	// Vertex index of the surface crossing each grid edge, keyed by the lower grid point index and the axis.
+	vertexOf := make(map[[2]int]int)
+
+	for z := 0; z+1 < n; z++ {
+		for y := 0; y+1 < n; y++ {
+			for x := 0; x+1 < n; x++ {
+				var corner [8]int
+				var val [8]float64
+				inside := 0
+				for c := 0; c < 8; c++ {
+					corner[c] = idx(x+c&1, y+(c>>1)&1, z+(c>>2)&1)
+					val[c] = density[corner[c]]
+					if val[c] > threshold {
+						inside |= 1 << c
+					}
+				}
+				if inside == 0 || inside == 0xff {
+					continue
+				}
+				// Returns the mesh vertex on the cube edge between corners a and b.
+				vertex := func(a, b int) int {
+					if a > b {
+						a, b = b, a
+					}
+					axis := 0
+					if b-a == 2 {
+						axis = 1
+					} else if b-a == 4 {
+						axis = 2
+					}
+					key := [2]int{corner[a], axis}
+					if v, ok := vertexOf[key]; ok {
+						return v
+					}
+					t := (threshold - val[a]) / (val[b] - val[a])
+					pa := [3]float64{pos(x + a&1), pos(y + (a>>1)&1), pos(z + (a>>2)&1)}
+					p := pa
+					p[axis] += t * step
+					re := real(psi[corner[a]]) + t*(real(psi[corner[b]])-real(psi[corner[a]]))
+					m.vertices = append(m.vertices, p)
+					m.vertexRe = append(m.vertexRe, re)
+					vertexOf[key] = len(m.vertices) - 1
+					return vertexOf[key]
+				}
+				in := func(c int) bool { return inside&(1<<c) != 0 }
+
+				// Directed segments between crossed edges, each edge given by its corner pair.
+				type edge [2]int
+				next := make(map[edge]edge)
+				// Crossed edges in the order first seen, so that the mesh is deterministic.
+				var order []edge
+				seen := make(map[edge]bool)
+				offset := func(c int) [3]float64 {
+					return [3]float64{float64(c & 1), float64(c >> 1 & 1), float64(c >> 2 & 1)}
+				}
+				mid := func(e edge) [3]float64 {
+					a, b := offset(e[0]), offset(e[1])
+					return [3]float64{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2, (a[2] + b[2]) / 2}
+				}
+				// Links the segment of face f between the crossed edges a and b, which separates corner c from the
+				// other corners. The segment is directed with the inside on its right seen from outside the cube, so
+				// that the two cubes sharing the face traverse it in opposite directions, and the normals of the loops
+				// point away from the inside.
+				link := func(f int, a, b edge, c int) {
+					var normal [3]float64
+					normal[f/2] = float64(2*(f%2) - 1)
+					p := mid(a)
+					if left := dot(cross(sub(mid(b), p), sub(offset(c), p)), normal) > 0; left == in(c) {
+						a, b = b, a
+					}
+					for _, e := range []edge{a, b} {
+						if !seen[e] {
+							seen[e] = true
+							order = append(order, e)
+						}
+					}
+					next[a] = b
+				}
+				for f, face := range cubeFaces {
+					var crossed []edge
+					for k := 0; k < 4; k++ {
+						a, b := face[k], face[(k+1)%4]
+						if in(a) != in(b) {
+							if a > b {
+								a, b = b, a
+							}
+							crossed = append(crossed, edge{a, b})
+						}
+					}
+					switch len(crossed) {
+					case 2:
+						link(f, crossed[0], crossed[1], crossed[0][0])
+					case 4:
+						// crossed[k] is the edge from face[k] to face[k+1], so crossed[k-1] and crossed[k] cut around
+						// face[k]. Cut around the pair of diagonal corners that are not connected through the center.
+						center := (val[face[0]] + val[face[1]] + val[face[2]] + val[face[3]]) / 4
+						k := 0
+						if in(face[0]) == (center > threshold) {
+							k = 1
+						}
+						link(f, crossed[(k+3)%4], crossed[k], face[k])
+						link(f, crossed[(k+1)%4], crossed[(k+2)%4], face[(k+2)%4])
+					}
+				}
+
+				// Chain the segments into loops and triangulate each loop as a fan.
+				visited := make(map[edge]bool)
+				for _, start := range order {
+					if visited[start] {
+						continue
+					}
+					var loop []int
+					var edges []edge
+					for cur := start; !visited[cur]; cur = next[cur] {
+						visited[cur] = true
+						loop = append(loop, vertex(cur[0], cur[1]))
+						edges = append(edges, cur)
+					}
+					// A diagonal of the fan between two vertices of an ambiguous face may coincide with one of the
+					// neighboring cube, which would leave the surface non-manifold. Fan from a vertex sharing no face
+					// with the vertices it isn't adjacent to, otherwise from a new vertex at the centroid.
+					apex := -1
+					for k := 0; k < len(loop) && apex < 0; k++ {
+						apex = k
+						for j := 2; j+1 < len(loop); j++ {
+							if shareFace(edges[k], edges[(k+j)%len(loop)]) {
+								apex = -1
+								break
+							}
+						}
+					}
+					center := -1
+					if apex >= 0 {
+						loop = append(loop[apex:], loop[:apex]...)
+					} else {
+						var p [3]float64
+						re := 0.0
+						for _, v := range loop {
+							for axis := range p {
+								p[axis] += m.vertices[v][axis] / float64(len(loop))
+							}
+							re += m.vertexRe[v] / float64(len(loop))
+						}
+						m.vertices = append(m.vertices, p)
+						m.vertexRe = append(m.vertexRe, re)
+						center = len(m.vertices) - 1
+					}
+					m.addLoop(loop, center)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// Adds the loop of vertices triangulated as a fan from its first vertex, or from the center vertex unless negative.
+func (m *mesh) addLoop(loop []int, center int) {
+	if center >= 0 {
+		for k := range loop {
+			m.faces = append(m.faces, [3]int{center, loop[k], loop[(k+1)%len(loop)]})
+		}
+		return
+	}
+	for k := 1; k+1 < len(loop); k++ {
+		m.faces = append(m.faces, [3]int{loop[0], loop[k], loop[k+1]})
+	}
+}
+
+// Reports whether the cube edges, given by their corner pairs, lie on a common face.
+func shareFace(a, b [2]int) bool {
+	for _, face := range cubeFaces {
+		on := func(c int) bool { return c == face[0] || c == face[1] || c == face[2] || c == face[3] }
+		if on(a[0]) && on(a[1]) && on(b[0]) && on(b[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sub(a, b [3]float64) [3]float64 { return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+
+func dot(a, b [3]float64) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// Face colors for the positive and negative lobes.
+var lobeColors = [2][3]uint8{{220, 60, 40}, {40, 90, 220}}
+
+func (m *mesh) lobeColor(f int) [3]uint8 {
+	if m.positive(f) {
+		return lobeColors[0]
+	}
+	return lobeColors[1]
+}
+
+// Writes Wavefront OBJ, with the faces of each sign using their own material from the accompanying .mtl file.
+func (m *mesh) writeOBJ(w *bufio.Writer, filename string) error {
+	mtlFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mtl"
+	var mtl strings.Builder
+	for k, name := range []string{"positive", "negative"} {
+		c := lobeColors[k]
+		fmt.Fprintf(&mtl, "newmtl %v\nKd %v %v %v\n\n", name, float64(c[0])/255, float64(c[1])/255, float64(c[2])/255)
+	}
+	if err := os.WriteFile(mtlFile, []byte(mtl.String()), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "mtllib %v\n", filepath.Base(mtlFile))
+	for _, v := range m.vertices {
+		fmt.Fprintf(w, "v %v %v %v\n", v[0], v[1], v[2])
+	}
+	for k, name := range []string{"positive", "negative"} {
+		fmt.Fprintf(w, "usemtl %v\n", name)
+		for f, face := range m.faces {
+			if m.positive(f) == (k == 0) {
+				fmt.Fprintf(w, "f %v %v %v\n", face[0]+1, face[1]+1, face[2]+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Writes ASCII PLY with per-face colors.
+func (m *mesh) writePLY(w *bufio.Writer) {
+	fmt.Fprintf(w, "ply\nformat ascii 1.0\n")
+	fmt.Fprintf(w, "element vertex %v\nproperty float x\nproperty float y\nproperty float z\n", len(m.vertices))
+	fmt.Fprintf(w, "element face %v\nproperty list uchar int vertex_indices\n", len(m.faces))
+	fmt.Fprintf(w, "property uchar red\nproperty uchar green\nproperty uchar blue\nend_header\n")
+	for _, v := range m.vertices {
+		fmt.Fprintf(w, "%v %v %v\n", v[0], v[1], v[2])
+	}
+	for f, face := range m.faces {
+		c := m.lobeColor(f)
+		fmt.Fprintf(w, "3 %v %v %v %v %v %v\n", face[0], face[1], face[2], c[0], c[1], c[2])
+	}
+}
+
+// Writes binary STL, with the face colors in the attribute bytes as 15-bit RGB with the valid bit set, as understood
+// by most viewers that support colored STL.
+func (m *mesh) writeSTL(w *bufio.Writer) {
+	w.Write(make([]byte, 80))
+	binary.Write(w, binary.LittleEndian, uint32(len(m.faces)))
+	for f, face := range m.faces {
+		pa, pb, pc := m.vertices[face[0]], m.vertices[face[1]], m.vertices[face[2]]
+		normal := cross(sub(pb, pa), sub(pc, pa))
+		if l := math.Sqrt(dot(normal, normal)); l > 0 {
+			normal = [3]float64{normal[0] / l, normal[1] / l, normal[2] / l}
+		}
+		for _, v := range [][3]float64{normal, pa, pb, pc} {
+			binary.Write(w, binary.LittleEndian, [3]float32{float32(v[0]), float32(v[1]), float32(v[2])})
+		}
+		c := m.lobeColor(f)
+		attr := uint16(1<<15) | uint16(c[0]>>3)<<10 | uint16(c[1]>>3)<<5 | uint16(c[2]>>3)
+		binary.Write(w, binary.LittleEndian, attr)
+	}
+}
@@ -0,0 +1,102 @@
+package hydrogen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Checks that the mesh is closed and consistently oriented, i.e., each edge is shared by two faces which traverse it
+// in opposite directions.
+func checkClosed(t *testing.T, m *mesh) {
+	t.Helper()
+	if len(m.faces) == 0 {
+		t.Fatal("empty mesh")
+	}
+	directed := make(map[[2]int]int)
+	for _, f := range m.faces {
+		for k := 0; k < 3; k++ {
+			a, b := f[k], f[(k+1)%3]
+			if a == b {
+				t.Fatalf("degenerate face %v", f)
+			}
+			directed[[2]int{a, b}]++
+		}
+	}
+	for e, cnt := range directed {
+		if cnt != 1 || directed[[2]int{e[1], e[0]}] != 1 {
+			t.Fatalf("edge %v is traversed %v times, and %v times in reverse", e, cnt, directed[[2]int{e[1], e[0]}])
+		}
+	}
+}
+
+func TestMarchingCubesClosed(t *testing.T) {
+	const n = 12
+	pos := func(k int) float64 { return float64(k) - n/2 }
+	idx := func(x, y, z int) int { return (z*n+y)*n + x }
+
+	// Random fields with many ambiguous faces, below the threshold on the boundary of the grid.
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		density := make([]float64, n*n*n)
+		psi := make([]complex128, n*n*n)
+		for z := 1; z+1 < n; z++ {
+			for y := 1; y+1 < n; y++ {
+				for x := 1; x+1 < n; x++ {
+					density[idx(x, y, z)] = rng.Float64()
+					psi[idx(x, y, z)] = complex(rng.Float64()-0.5, 0)
+				}
+			}
+		}
+		checkClosed(t, marchingCubes(n, density, psi, 0.5, pos))
+	}
+
+	// The normals of a sphere point outwards, i.e., away from the inside.
+	density := make([]float64, n*n*n)
+	for z := 0; z < n; z++ {
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				density[idx(x, y, z)] = -(pos(x)*pos(x) + pos(y)*pos(y) + pos(z)*pos(z))
+			}
+		}
+	}
+	m := marchingCubes(n, density, make([]complex128, n*n*n), -16, pos)
+	checkClosed(t, m)
+	for _, f := range m.faces {
+		a, b, c := m.vertices[f[0]], m.vertices[f[1]], m.vertices[f[2]]
+		if dot(cross(sub(b, a), sub(c, a)), a) <= 0 {
+			t.Fatalf("face %v %v %v points inwards", a, b, c)
+		}
+	}
+
+	// The lobes of a 3d orbital.
+	cfg := testConfig(t, map[string]interface{}{"n": 3, "l": 2, "m": 1, "orbitals": "real"})
+	rd, err := newRenderer(cfg, []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const extent = 25.0
+	grid := func(k int) float64 { return -extent + 2*extent*float64(k)/(n-1) }
+	density = make([]float64, n*n*n)
+	psi := make([]complex128, n*n*n)
+	for z := 0; z < n; z++ {
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				psi[idx(x, y, z)] = rd.amplitude(grid(x), grid(y), grid(z))
+				density[idx(x, y, z)] = math.Pow(real(psi[idx(x, y, z)]), 2) + math.Pow(imag(psi[idx(x, y, z)]), 2)
+			}
+		}
+	}
+	m = marchingCubes(n, density, psi, enclosingThreshold(density, 0.9), grid)
+	checkClosed(t, m)
+	// Both signs of the real orbital are present.
+	positive := 0
+	for f := range m.faces {
+		if m.positive(f) {
+			positive++
+		}
+	}
+	if positive == 0 || positive == len(m.faces) {
+		t.Errorf("%v of %v faces are positive", positive, len(m.faces))
+	}
+}
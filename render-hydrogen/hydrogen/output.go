@@ -0,0 +1,168 @@
+package hydrogen
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/big"
+	"os"
+)
+
+// Writes the raw output and the images of the frames rendered with the given number of escalated pixels, see images().
+func (rd *renderer) finish(ctx context.Context, frames []*frame, escalated int) error {
+	imgs, err := rd.images(ctx, frames, escalated)
+	if err != nil {
+		return err
+	}
+	if rd.cfg.RawOutput != nil {
+		if err := writeRaw(rd.cfg, frames); err != nil {
+			return err
+		}
+	}
+	return writeImages(rd.cfg, imgs)
+}
+
+// Reports the escalation, refines the frames if configured, and returns the output images, given the frames rendered
+// with the given number of escalated pixels. Stops with ctx.Err() once ctx is done during the refinement.
+func (rd *renderer) images(ctx context.Context, frames []*frame, escalated int) ([]*image.RGBA, error) {
+	cfg, times := rd.cfg, rd.times
+	if rd.fe != nil && !rd.fastOnly {
+		total := cfg.ImageSize * cfg.ImageSize
+		cfg.logf("%v of %v pixels (%.2f%%) escalated to big.Float\n",
+			escalated, total, 100*float64(escalated)/float64(total))
+	}
+	if cfg.AdaptiveThreshold > 0 {
+		// The refinement is neither checkpointed nor distributed.
+		refined, refinedEscalated, err := rd.refine(ctx, frames)
+		if err != nil {
+			return nil, err
+		}
+		if rd.fe != nil && !rd.fastOnly {
+			cfg.logf("%v of %v refined pixels escalated to big.Float\n", refinedEscalated, refined)
+		}
+	}
+
+	// For normalization calculation, shared by all frames so that the brightness is comparable across the animation,
+	// the turntable and the stereo pair.
+	max := maxDensity(frames)
+	if cfg.Normalization == absoluteNormalization {
+		// The max density helps choose absoluteMax.
+		cfg.logf("max density %.6g %v, heatmap top at %v %v\n",
+			cfg.physicalDensity(max), cfg.unit("-3"), cfg.AbsoluteMax, cfg.unit("-3"))
+	}
+
+	scale := cfg.normalizationScale(max)
+	if cfg.ColorMode == signedColorMode {
+		scale = maxRealPart(frames)
+	}
+	if scale.Sign() == 0 {
+		cfg.logf("the rendered state vanishes everywhere in the view, e.g., in a nodal plane\n")
+	}
+	colorized := make([]*image.RGBA, len(frames))
+	for f, fr := range frames {
+		colorized[f] = colorize(cfg, fr, scale)
+	}
+	imgs := composeImages(cfg, colorized, len(times))
+	if cfg.Annotate {
+		top := cfg.physicalDensity(scale)
+		// Each image shows one turntable step at one time, and the eyes of a stereo pair share the azimuth.
+		views := cfg.views()
+		steps := len(imgs) / len(times)
+		for o, img := range imgs {
+			imgs[o] = annotate(cfg, img, top, views[o/len(times)*len(views)/steps].phi, times[o%len(times)])
+		}
+	}
+	return imgs, nil
+}
+
+// Writes the single image to cfg.OutputFile, or the numbered frames and the animated GIF.
+func writeImages(cfg *Config, imgs []*image.RGBA) error {
+	if len(imgs) == 1 {
+		return writePNG(cfg.OutputFile, imgs[0])
+	}
+	for f, img := range imgs {
+		if err := writePNG(frameFile(cfg.OutputFile, f), img); err != nil {
+			return err
+		}
+	}
+	if cfg.Turntable != nil {
+		return writeGIF(cfg, imgs, cfg.Turntable.GIFFile, cfg.Turntable.FrameDelay)
+	}
+	return writeGIF(cfg, imgs, cfg.Animation.GIFFile, cfg.Animation.FrameDelay)
+}
+
+// Maps the frame data to colors, normalized by max, which is mapped to the top of the heatmap. For signed coloring,
+// max is the max of |Re psi|. If max is zero, e.g., for a view in a nodal plane, all pixels get the color of zero.
+func colorize(cfg *Config, fr *frame, max *big.Float) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, cfg.ImageSize, cfg.ImageSize))
+	for i := 0; i < cfg.ImageSize; i++ {
+		for j := 0; j < cfg.ImageSize; j++ {
+			pixel := fr.data[j*cfg.ImageSize+i]
+			if cfg.ColorMode == signedColorMode {
+				pixel = fr.amps[j*cfg.ImageSize+i].re
+			}
+			normalized := 0.0
+			if max.Sign() != 0 {
+				normalized, _ = new(big.Float).Quo(pixel, max).Float64()
+			}
+			if cfg.ColorMode == signedColorMode {
+				img.SetRGBA64(i, j, cfg.heatmapColor(cfg.signedToneMap(normalized)))
+				continue
+			}
+			val := cfg.toneMap(normalized)
+			if fr.amps != nil {
+				img.SetRGBA64(i, j, phaseColor(fr.amps[j*cfg.ImageSize+i].arg(), val))
+				continue
+			}
+			img.SetRGBA64(i, j, cfg.heatmapColor(val))
+		}
+	}
+	return img
+}
+
+// Maps the density normalized to [0,1] to the position in [0,1] on the heatmap, according to the scale, clipping and
+// exposure.
+func (cfg *Config) toneMap(normalized float64) float64 {
+	val := normalized
+	if cfg.Scale == logScale {
+		val = 0
+		if normalized > 0 {
+			val = math.Max(0, 1+math.Log10(normalized)/cfg.LogDecades)
+		}
+	}
+	val = (val - cfg.ClipLow) / (cfg.ClipHigh - cfg.ClipLow)
+	val = math.Min(1, math.Max(0, val))
+	// Adjust for exposure for best visual contrast.
+	return math.Pow(val, 1.0/float64(cfg.Exposure))
+}
+
+// Maps Re psi normalized to [-1,1] to the position in [0,1] on the heatmap, tone mapping the magnitude on either side
+// of the middle.
+func (cfg *Config) signedToneMap(normalized float64) float64 {
+	if normalized < 0 {
+		return 0.5 - 0.5*cfg.toneMap(-normalized)
+	}
+	return 0.5 + 0.5*cfg.toneMap(normalized)
+}
+
+// Looks up the heatmap color at position val in [0,1], clamping anything else, e.g., NaN from corrupt raw data.
+func (cfg *Config) heatmapColor(val float64) color.RGBA64 {
+	if !(val >= 0) {
+		val = 0
+	}
+	val = math.Min(1, val)
+	heatmapPos := int(val * float64(len(cfg.heatmap)-1))
+	r, g, b, a := cfg.heatmap[heatmapPos].RGBA()
+	return color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: uint16(a)}
+}
+
+func writePNG(filename string, img image.Image) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return png.Encode(out, img)
+}
@@ -0,0 +1,138 @@
+package hydrogen
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/big"
+)
+
+// Returns the renderer of the panel sharing the evaluator and the phases of rd, which is rd itself for the camera's
+// view. A cutting plane is rendered as the single layer of an orthographic camera looking against its normal.
+func (rd *renderer) panelRenderer(p Panel) *renderer {
+	if p.Normal == nil {
+		return rd
+	}
+	n := *p.Normal
+	norm := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	for k := range n {
+		n[k] /= norm
+	}
+	pcfg := *rd.cfg
+	pcfg.plane = &p
+	pcfg.CameraTheta = math.Acos(n[2])
+	// Looking down the z axis, x points to the right and y up.
+	pcfg.CameraPhi = -math.Pi / 2
+	if n[0] != 0 || n[1] != 0 {
+		pcfg.CameraPhi = math.Atan2(n[1], n[0])
+	}
+	pcfg.CameraRoll = 0
+	// The plane is centered at the projection of lookAt.
+	dist := n[0]*pcfg.LookAt[0] + n[1]*pcfg.LookAt[1] + n[2]*pcfg.LookAt[2] - p.Offset
+	for k := range n {
+		pcfg.LookAt[k] -= dist * n[k]
+	}
+	pcfg.FOVSize = AutoLength{Value: rd.cfg.viewSize()}
+	pcfg.Projection = orthographicProjection
+	pcfg.Layers = 1
+	pcfg.Compositing = sumCompositing
+	pcfg.SliceLayer = 0
+	return &renderer{
+		cfg:      &pcfg,
+		views:    []*screen{newScreen(&pcfg, view{phi: pcfg.CameraPhi})},
+		eval:     rd.eval,
+		fe:       rd.fe,
+		fastOnly: rd.fastOnly,
+		times:    rd.times,
+		phases:   rd.phases,
+		samples:  rd.samples,
+	}
+}
+
+// Renders all panels locally and returns the images of all times, each with the panels laid out in rows of
+// cfg.PanelColumns, and the frames of each panel.
+func renderPanels(ctx context.Context, rd *renderer) ([]*image.RGBA, [][]*frame, error) {
+	cfg := rd.cfg
+	renderers := make([]*renderer, len(cfg.Panels))
+	frames := make([][]*frame, len(cfg.Panels))
+	for k, p := range cfg.Panels {
+		renderers[k] = rd.panelRenderer(p)
+		var escalated int
+		var err error
+		frames[k], escalated, err = renderers[k].render(ctx, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rd.fe != nil && !rd.fastOnly {
+			total := cfg.ImageSize * cfg.ImageSize
+			cfg.logf("panel %v: %v of %v pixels (%.2f%%) escalated to big.Float\n",
+				k, escalated, total, 100*float64(escalated)/float64(total))
+		}
+		if cfg.AdaptiveThreshold > 0 {
+			refined, refinedEscalated, err := renderers[k].refine(ctx, frames[k])
+			if err != nil {
+				return nil, nil, err
+			}
+			if rd.fe != nil && !rd.fastOnly {
+				cfg.logf("panel %v: %v of %v refined pixels escalated to big.Float\n", k, refinedEscalated, refined)
+			}
+		}
+	}
+
+	// The scale of each panel, for signed coloring the max of |Re psi|.
+	scales := make([]*big.Float, len(cfg.Panels))
+	for k := range cfg.Panels {
+		if cfg.ColorMode == signedColorMode {
+			scales[k] = maxRealPart(frames[k])
+		} else {
+			scales[k] = renderers[k].cfg.normalizationScale(maxDensity(frames[k]))
+		}
+	}
+	if cfg.PanelNormalization == sharedPanelNormalization {
+		// Compare the panels by the physical density, or the mean Re psi over the layers, since the camera's view may
+		// composite many layers.
+		shared := 0.0
+		for k := range cfg.Panels {
+			if d := renderers[k].cfg.physicalDensity(scales[k]); d > shared {
+				shared = d
+			}
+		}
+		for k := range cfg.Panels {
+			scales[k] = renderers[k].cfg.compositedData(shared)
+		}
+	}
+
+	for k := range cfg.Panels {
+		if scales[k].Sign() == 0 {
+			cfg.logf("panel %v: the rendered state vanishes everywhere in the panel, e.g., in a nodal plane\n", k)
+		}
+	}
+
+	imgs := make([]*image.RGBA, len(rd.times))
+	for t := range imgs {
+		tiles := make([]*image.RGBA, len(cfg.Panels))
+		for k, prd := range renderers {
+			tiles[k] = colorize(prd.cfg, frames[k][t], scales[k])
+			if cfg.Annotate {
+				top := prd.cfg.physicalDensity(scales[k])
+				tiles[k] = annotate(prd.cfg, tiles[k], top, prd.cfg.CameraPhi, rd.times[t])
+			}
+		}
+		imgs[t] = layoutPanels(tiles, cfg.PanelColumns)
+	}
+	return imgs, frames, nil
+}
+
+// Lays out the tiles in rows of the given number of columns, on a black background.
+func layoutPanels(tiles []*image.RGBA, columns int) *image.RGBA {
+	w, h := tiles[0].Bounds().Dx(), tiles[0].Bounds().Dy()
+	rows := (len(tiles) + columns - 1) / columns
+	img := image.NewRGBA(image.Rect(0, 0, columns*w, rows*h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for k, tile := range tiles {
+		draw.Draw(img, tile.Bounds().Add(image.Pt(k%columns*w, k/columns*h)), tile, image.Point{}, draw.Src)
+	}
+	return img
+}
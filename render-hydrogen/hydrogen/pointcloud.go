@@ -0,0 +1,300 @@
+package hydrogen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/ALTree/bigfloat"
+	"github.com/euphoricrhino/sakurai-go/util"
+)
+
+// Points sampled with the same random source, so that the point cloud only depends on the seed and not on the
+// concurrency.
+const pointChunk = 1000
+
+// Samples the radial distance of a single (n,l,m) state by inverting its cumulative distribution.
+type radialSampler struct {
+	// The radial probability density r^2 R(r)^2 is density(r)e^{-ar}, with r in units of the Bohr radius of the ion.
+	density *polynomial
+	a       *big.Float
+	// The antiderivative of density(r)e^{-ar} is -primitive(r)e^{-ar}, so the probability beyond r is
+	// primitive(r)e^{-ar}/total with total=primitive(0).
+	primitive *polynomial
+	total     *big.Float
+	// Float64 counterparts of the above, the tail is evaluated in float64 unless it loses precision.
+	densityCoeff, primitiveCoeff []scaled
+	af                           float64
+	// Precision of the big.Float arithmetic in bits.
+	prec uint
+}
+
+func newRadialSampler(prec uint, t *termEvaluator) *radialSampler {
+	rn := radialNorm(prec, t.n, t.l)
+	rad := &polynomial{coeff: make([]*big.Float, len(t.radPoly.coeff))}
+	for k, c := range t.radPoly.coeff {
+		if c != nil {
+			rad.coeff[k] = blankFloat(prec).Mul(c, rn)
+		}
+	}
+	rs := &radialSampler{
+		density: rad.mul(rad).mul(&polynomial{coeff: []*big.Float{nil, nil, newFromFloat64(prec, 1.0)}}),
+		a:       newFromRat(prec, 2, t.n),
+		prec:    prec,
+	}
+	// primitive solves a primitive-primitive'=density, i.e., primitive_k=(density_k+(k+1)primitive_{k+1})/a.
+	deg := len(rs.density.coeff) - 1
+	rs.primitive = &polynomial{coeff: make([]*big.Float, deg+1)}
+	next := blankFloat(prec)
+	for k := deg; k >= 0; k-- {
+		c := blankFloat(prec).Mul(next, newFromInt(prec, k+1))
+		if rs.density.coeff[k] != nil {
+			c.Add(c, rs.density.coeff[k])
+		}
+		rs.primitive.coeff[k] = c.Quo(c, rs.a)
+		next = c
+	}
+	rs.total = rs.primitive.coeff[0]
+	rs.af, _ = rs.a.Float64()
+	inv := blankFloat(prec).Quo(newFromInt(prec, 1), rs.total)
+	for _, c := range rs.density.coeff {
+		if c != nil {
+			c = blankFloat(prec).Mul(c, inv)
+		}
+		rs.densityCoeff = append(rs.densityCoeff, scaledFromBig(c))
+	}
+	for _, c := range rs.primitive.coeff {
+		rs.primitiveCoeff = append(rs.primitiveCoeff, scaledFromBig(blankFloat(prec).Mul(c, inv)))
+	}
+	return rs
+}
+
+// Returns the probability beyond r minus v, and its derivative in r, in float64 if accurate enough.
+func (rs *radialSampler) tail(r, v float64) (float64, float64) {
+	exp := scaledExpNeg(rs.af * r)
+	p, pAbs := hornerScaled(rs.primitiveCoeff, r)
+	d, dAbs := hornerScaled(rs.densityCoeff, r)
+	ops := float64(2*len(rs.primitiveCoeff)+16) * 0x1p-52
+	if !p.abs().mul(newScaled(escalationTolerance)).less(pAbs.mul(newScaled(ops))) &&
+		!d.abs().mul(newScaled(escalationTolerance)).less(dAbs.mul(newScaled(ops))) {
+		return p.mul(exp).float64() - v, -d.mul(exp).float64()
+	}
+	return rs.tailBig(r, v)
+}
+
+// Same as tail() but in big.Float.
+func (rs *radialSampler) tailBig(r, v float64) (float64, float64) {
+	rb := newFromFloat64(rs.prec, r)
+	exp := bigfloat.Exp(blankFloat(rs.prec).Neg(blankFloat(rs.prec).Mul(rs.a, rb)))
+	exp.Quo(exp, rs.total)
+	f := blankFloat(rs.prec).Mul(rs.primitive.eval(rb), exp)
+	f.Sub(f, newFromFloat64(rs.prec, v))
+	df := blankFloat(rs.prec).Mul(rs.density.eval(rb), exp)
+	fv, _ := f.Float64()
+	dfv, _ := df.Neg(df).Float64()
+	return fv, dfv
+}
+
+// Returns the radial distance beyond which the probability is v in (0,1], with Newton's method safeguarded by
+// bisection.
+func (rs *radialSampler) invert(v float64) float64 {
+	lo, hi := 0.0, 1.0
+	for {
+		if f, _ := rs.tail(hi, v); f < 0 {
+			break
+		}
+		lo, hi = hi, 2*hi
+	}
+	r := (lo + hi) / 2
+	for iter := 0; iter < 200 && hi-lo > 1e-15*hi; iter++ {
+		f, df := rs.tail(r, v)
+		if f > 0 {
+			lo = r
+		} else {
+			hi = r
+		}
+		next := r - f/df
+		if df == 0 || !(next > lo && next < hi) {
+			next = (lo + hi) / 2
+		}
+		if math.Abs(next-r) <= 1e-15*r {
+			return next
+		}
+		r = next
+	}
+	return r
+}
+
+// Samples the direction of a single (n,l,m) state by rejection against the bound |Y_l^m|^2<=(2l+1)/4pi, or twice that
+// for the real orbitals.
+type angularSampler struct {
+	t *termEvaluator
+	// The angular density over the bound is (l-|m|)!/(l+|m|)! |P_l^|m|(cos(theta))|^2 times the azimuthal part squared,
+	// the factor 2 of the real orbitals cancelling with their bound.
+	scale *big.Float
+	// Precision of the big.Float arithmetic in bits.
+	prec uint
+}
+
+func newAngularSampler(prec uint, t *termEvaluator) *angularSampler {
+	absM := t.m
+	if absM < 0 {
+		absM = -absM
+	}
+	scale := blankFloat(prec).SetInt(util.Factorial(t.l - absM))
+	return &angularSampler{t: t, prec: prec, scale: scale.Quo(scale, blankFloat(prec).SetInt(util.Factorial(t.l+absM)))}
+}
+
+// Returns the angular density at (cos(theta),phi) over the bound, in [0,1].
+func (as *angularSampler) ratio(ct, phi float64) float64 {
+	st := math.Sqrt(1 - ct*ct)
+	sp := newComplex(newFromFloat64(as.prec, st*math.Cos(phi)), newFromFloat64(as.prec, st*math.Sin(phi)))
+	ang := blankComplex(as.prec).scale(as.t.phase(sp), as.t.angularPoly.eval(newFromFloat64(as.prec, ct)))
+	ratio, _ := blankFloat(as.prec).Mul(ang.abs2(), as.scale).Float64()
+	return ratio
+}
+
+// Returns cos(theta) and phi of a direction sampled from the angular density.
+func (as *angularSampler) sample(rng *rand.Rand) (float64, float64) {
+	for {
+		ct, phi := 2*rng.Float64()-1, 2*math.Pi*rng.Float64()
+		if rng.Float64() < as.ratio(ct, phi) {
+			return ct, phi
+		}
+	}
+}
+
+// Returns the product of the polynomials.
+func (poly *polynomial) mul(other *polynomial) *polynomial {
+	ans := &polynomial{coeff: make([]*big.Float, len(poly.coeff)+len(other.coeff)-1)}
+	for j, a := range poly.coeff {
+		for k, b := range other.coeff {
+			if a == nil || b == nil {
+				continue
+			}
+			if ans.coeff[j+k] == nil {
+				ans.coeff[j+k] = new(big.Float)
+			}
+			ans.coeff[j+k].Add(ans.coeff[j+k], new(big.Float).Mul(a, b))
+		}
+	}
+	return ans
+}
+
+// Samples points from |psi|^2 of the single state of the config, the radial distance by exact inversion of its
+// cumulative distribution, and the direction by rejection. Writes them in all configured formats, colored by the sign
+// of Re psi like the isosurface, and the image of the point density as seen by the camera. The points only depend on
+// the seed. Stops with ctx.Err() once ctx is done during the sampling.
+func exportPointCloud(ctx context.Context, rd *renderer, seed int64) error {
+	cfg := rd.cfg
+	pc := cfg.PointCloud
+	t := rd.eval.terms[0]
+	rs := newRadialSampler(rd.eval.prec, t)
+	scale, _ := rd.eval.scale.Float64()
+	as := newAngularSampler(rd.eval.prec, t)
+
+	points := make([][3]float64, pc.Points)
+	positive := make([]bool, pc.Points)
+	chunks := (pc.Points + pointChunk - 1) / pointChunk
+	var wg, progressWg sync.WaitGroup
+	ch := showProgress(cfg, pc.Points, &progressWg)
+	wg.Add(cfg.Concurrency)
+	for w := 0; w < cfg.Concurrency; w++ {
+		go func(shard int) {
+			defer wg.Done()
+			for c := shard; c < chunks; c += cfg.Concurrency {
+				if ctx.Err() != nil {
+					return
+				}
+				rng := rand.New(rand.NewSource(seed + int64(c)))
+				for p := c * pointChunk; p < (c+1)*pointChunk && p < pc.Points; p++ {
+					r := rs.invert(1-rng.Float64()) / scale
+					ct, phi := as.sample(rng)
+					st := math.Sqrt(1 - ct*ct)
+					points[p] = [3]float64{r * st * math.Cos(phi), r * st * math.Sin(phi), r * ct}
+					positive[p] = real(rd.amplitude(points[p][0], points[p][1], points[p][2])) >= 0
+					ch <- struct{}{}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ch)
+	progressWg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rd.cfg.logf("%v points sampled with seed %v\n", pc.Points, seed)
+
+	for _, format := range pc.Formats {
+		out, err := os.Create(pc.File + "." + format)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(out)
+		switch format {
+		case "csv":
+			w.WriteString("x,y,z,positive\n")
+			for p, pt := range points {
+				fmt.Fprintf(w, "%v,%v,%v,%v\n", pt[0], pt[1], pt[2], positive[p])
+			}
+		case "ply":
+			writePointsPLY(w, points, positive)
+		}
+		err = w.Flush()
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writePNG(pc.File+".png", pointImage(cfg, points))
+}
+
+// Writes ASCII PLY with per-vertex colors.
+func writePointsPLY(w *bufio.Writer, points [][3]float64, positive []bool) {
+	fmt.Fprintf(w, "ply\nformat ascii 1.0\n")
+	fmt.Fprintf(w, "element vertex %v\nproperty float x\nproperty float y\nproperty float z\n", len(points))
+	fmt.Fprintf(w, "property uchar red\nproperty uchar green\nproperty uchar blue\nend_header\n")
+	for p, pt := range points {
+		c := lobeColors[1]
+		if positive[p] {
+			c = lobeColors[0]
+		}
+		fmt.Fprintf(w, "%v %v %v %v %v %v\n", pt[0], pt[1], pt[2], c[0], c[1], c[2])
+	}
+}
+
+// Projects the points through the camera, and maps the number of points in each pixel relative to the max to the
+// heatmap with the tone mapping of the config.
+func pointImage(cfg *Config, points [][3]float64) *image.RGBA {
+	size := cfg.ImageSize
+	scr := newScreen(cfg, view{phi: cfg.CameraPhi})
+	counts := make([]int, size*size)
+	max := 0
+	for _, pt := range points {
+		x, y, ok := scr.worldToPixel(pt)
+		i, j := int(math.Round(x)), int(math.Round(y))
+		if !ok || i < 0 || i >= size || j < 0 || j >= size {
+			continue
+		}
+		counts[j*size+i]++
+		if counts[j*size+i] > max {
+			max = counts[j*size+i]
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for p, cnt := range counts {
+		val := 0.0
+		if max > 0 {
+			val = cfg.toneMap(float64(cnt) / float64(max))
+		}
+		img.SetRGBA64(p%size, p/size, cfg.heatmapColor(val))
+	}
+	return img
+}
@@ -0,0 +1,122 @@
+package hydrogen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Returns the radial probability density r^2 R_nl(r)^2, with r in units of the Bohr radius.
+func radialDensity(n, l int) func(float64) float64 {
+	rn, _ := radialNorm(testPrec, n, l).Float64()
+	poly := radialPoly(testPrec, n, l)
+	return func(r float64) float64 {
+		p, _ := poly.eval(newFromFloat64(testPrec, r)).Float64()
+		rad := rn * p * math.Exp(-r/float64(n))
+		return r * r * rad * rad
+	}
+}
+
+func TestRadialSamplerQuantiles(t *testing.T) {
+	testConfig(t, nil)
+	const samples = 20000
+	for _, s := range [][2]int{{1, 0}, {2, 1}, {3, 0}, {4, 2}, {6, 5}, {8, 3}} {
+		n, l := s[0], s[1]
+		t.Run(fmt.Sprintf("%v-%v", n, l), func(t *testing.T) {
+			rs := newRadialSampler(testPrec, &termEvaluator{n: n, l: l, radPoly: radialPoly(testPrec, n, l)})
+			density := radialDensity(n, l)
+			cdf := func(r float64) float64 { return simpson(density, 0, r, 4000) }
+			// The inversion is exact.
+			for _, v := range []float64{0.01, 0.1, 0.3, 0.5, 0.7, 0.9, 0.99} {
+				r := rs.invert(v)
+				if got := 1 - cdf(r); math.Abs(got-v) > 1e-8 {
+					t.Errorf("probability beyond invert(%v)=%v is %v", v, r, got)
+				}
+			}
+			// The empirical quantiles of the samples are distributed per the analytic CDF.
+			rng := rand.New(rand.NewSource(1))
+			radii := make([]float64, samples)
+			for k := range radii {
+				radii[k] = rs.invert(1 - rng.Float64())
+			}
+			sort.Float64s(radii)
+			for _, q := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+				got := cdf(radii[int(q*samples)])
+				if tol := 5 * math.Sqrt(q*(1-q)/samples); math.Abs(got-q) > tol {
+					t.Errorf("CDF at the empirical %v quantile is %v", q, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAngularSampler(t *testing.T) {
+	const samples = 20000
+	for _, s := range []struct {
+		l, m   int
+		isReal bool
+	}{{0, 0, false}, {2, 1, false}, {3, -2, false}, {4, 0, false}, {2, 1, true}, {3, -2, true}, {5, 5, true}} {
+		orbitals := complexOrbitals
+		if s.isReal {
+			orbitals = realOrbitals
+		}
+		t.Run(fmt.Sprintf("%v-%v-%v", s.l, s.m, orbitals), func(t *testing.T) {
+			cfg := testConfig(t, map[string]interface{}{"n": s.l + 1, "l": s.l, "m": s.m, "orbitals": orbitals})
+			as := newAngularSampler(testPrec, newEvaluator(cfg).terms[0])
+			// The density never exceeds the bound.
+			for i := 0; i <= 100; i++ {
+				for j := 0; j < 100; j++ {
+					ct, phi := -1+float64(i)/50, 2*math.Pi*float64(j)/100
+					if ratio := as.ratio(ct, phi); ratio > 1+1e-12 {
+						t.Fatalf("density over the bound at (%v,%v) is %v", ct, phi, ratio)
+					}
+				}
+			}
+
+			// The marginal density of cos(theta) is 2pi N^2 P_l^|m|(cos(theta))^2 for both the complex and the real
+			// orbitals, and that of phi is uniform, or cos(m phi)^2/pi or sin(|m| phi)^2/pi for the real orbitals.
+			absM := s.m
+			if absM < 0 {
+				absM = -absM
+			}
+			an, _ := angularNorm(testPrec, s.l, absM).Float64()
+			poly := angular(testPrec, s.l, absM)
+			ctDensity := func(ct float64) float64 {
+				p, _ := poly.eval(newFromFloat64(testPrec, ct)).Float64()
+				p *= math.Pow(1-ct*ct, float64(absM)/2)
+				return 2 * math.Pi * an * an * p * p
+			}
+			phiDensity := func(phi float64) float64 {
+				switch {
+				case !s.isReal || s.m == 0:
+					return 1 / (2 * math.Pi)
+				case s.m > 0:
+					return math.Pow(math.Cos(float64(s.m)*phi), 2) / math.Pi
+				default:
+					return math.Pow(math.Sin(float64(absM)*phi), 2) / math.Pi
+				}
+			}
+			const bins = 10
+			var ctCounts, phiCounts [bins]int
+			rng := rand.New(rand.NewSource(1))
+			for k := 0; k < samples; k++ {
+				ct, phi := as.sample(rng)
+				ctCounts[int(math.Min((ct+1)/2*bins, bins-1))]++
+				phiCounts[int(math.Min(phi/(2*math.Pi)*bins, bins-1))]++
+			}
+			check := func(name string, counts [bins]int, density func(float64) float64, lo, hi float64) {
+				w := (hi - lo) / bins
+				for b, cnt := range counts {
+					p := simpson(density, lo+float64(b)*w, lo+float64(b+1)*w, 200)
+					if tol := 5*math.Sqrt(samples*p*(1-p)) + 1; math.Abs(float64(cnt)-samples*p) > tol {
+						t.Errorf("%v bin %v has %v samples, expecting %v", name, b, cnt, samples*p)
+					}
+				}
+			}
+			check("cos(theta)", ctCounts, ctDensity, -1, 1)
+			check("phi", phiCounts, phiDensity, 0, 2*math.Pi)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package hydrogen
+
+import (
+	"context"
+	"time"
+)
+
+// Returns the renderer of the preview sharing the evaluator and the phases of rd. The preview shows the first time of
+// the camera's view, or of the panels, at cfg.Preview.ImageSize without supersampling, evaluated in float64 only.
+func (rd *renderer) previewRenderer() *renderer {
+	pcfg := *rd.cfg
+	pcfg.ImageSize = rd.cfg.Preview.ImageSize
+	pcfg.OutputFile = rd.cfg.Preview.File
+	pcfg.Supersampling = 1
+	pcfg.AdaptiveThreshold = 0
+	pcfg.Animation = nil
+	pcfg.Turntable = nil
+	pcfg.RawOutput = nil
+	prd := &renderer{
+		cfg:       &pcfg,
+		eval:      rd.eval,
+		fe:        rd.fe,
+		fastOnly:  true,
+		times:     rd.times[:1],
+		phases:    rd.phases[:1],
+		samples:   1,
+		reference: rd.reference,
+	}
+	if prd.fe == nil {
+		prd.fe = newFastEvaluator(rd.eval)
+	}
+	for _, v := range pcfg.views() {
+		prd.views = append(prd.views, newScreen(&pcfg, v))
+	}
+	return prd
+}
+
+// Renders the preview locally and writes it to cfg.Preview.File.
+func renderPreview(ctx context.Context, rd *renderer) error {
+	start := time.Now()
+	prd := rd.previewRenderer()
+	if len(prd.cfg.Panels) > 0 {
+		imgs, _, err := renderPanels(ctx, prd)
+		if err != nil {
+			return err
+		}
+		if err := writeImages(prd.cfg, imgs); err != nil {
+			return err
+		}
+	} else {
+		frames, _, err := prd.render(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := prd.finish(ctx, frames, 0); err != nil {
+			return err
+		}
+	}
+	prd.cfg.logf("preview written to %v in %v\n", prd.cfg.Preview.File, time.Since(start).Round(time.Millisecond))
+	return nil
+}
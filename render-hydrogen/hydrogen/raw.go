@@ -0,0 +1,139 @@
+package hydrogen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Writes the raw density of the frames in all configured formats.
+func writeRaw(cfg *Config, frames []*frame) error {
+	ro := cfg.RawOutput
+	size := cfg.ImageSize
+	for f, fr := range frames {
+		summed := fr.density()
+		for _, format := range ro.Formats {
+			filename := ro.File + "." + format
+			layersFilename := ro.File + "-layers." + format
+			if len(frames) > 1 {
+				filename = frameFile(filename, f)
+				layersFilename = frameFile(layersFilename, f)
+			}
+			if err := writeRawFile(cfg, filename, format, summed, 1); err != nil {
+				return err
+			}
+			if fr.layers != nil {
+				if err := writeRawFile(cfg, layersFilename, format, fr.layers, cfg.Layers); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	cfg.logf("raw %vx%v density written to %v.*\n", size, size, ro.File)
+	return nil
+}
+
+// Returns the composited data of the frame in float64.
+func (fr *frame) density() []float64 {
+	density := make([]float64, len(fr.data))
+	for p, d := range fr.data {
+		density[p], _ = d.Float64()
+	}
+	return density
+}
+
+// Writes the volume of layers x ImageSize x ImageSize values, indexed by k*ImageSize^2+j*ImageSize+i.
+func writeRawFile(cfg *Config, filename, format string, data []float64, layers int) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	switch format {
+	case "npy":
+		writeNPY(w, cfg, data, layers)
+	case "csv":
+		writeCSV(w, cfg, data, layers)
+	case "vtk":
+		writeVTK(w, cfg, data, layers)
+	}
+	return w.Flush()
+}
+
+// Writes NumPy .npy format version 1.0, with shape (ImageSize, ImageSize) for a single layer, or
+// (layers, ImageSize, ImageSize) otherwise, so that a[j][i] is pixel (i,j).
+func writeNPY(w *bufio.Writer, cfg *Config, data []float64, layers int) {
+	shape := fmt.Sprintf("(%v, %v)", cfg.ImageSize, cfg.ImageSize)
+	if layers > 1 {
+		shape = fmt.Sprintf("(%v, %v, %v)", layers, cfg.ImageSize, cfg.ImageSize)
+	}
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': %v, }", shape)
+	// Magic, version and header length take 10 bytes, the header is padded so that the data is 64-byte aligned.
+	pad := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", pad%64) + "\n"
+	w.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(w, binary.LittleEndian, uint16(len(header)))
+	w.WriteString(header)
+	binary.Write(w, binary.LittleEndian, data)
+}
+
+// Writes CSV with one image row per line for a single layer, or one "layer,row,column,density" line per value
+// otherwise.
+func writeCSV(w *bufio.Writer, cfg *Config, data []float64, layers int) {
+	size := cfg.ImageSize
+	if layers == 1 {
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				w.WriteString(strconv.FormatFloat(data[j*size+i], 'g', -1, 64))
+			}
+			w.WriteByte('\n')
+		}
+		return
+	}
+	w.WriteString("layer,row,column,density\n")
+	for k := 0; k < layers; k++ {
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				fmt.Fprintf(w, "%v,%v,%v,%v\n", k, j, i, strconv.FormatFloat(data[k*size*size+j*size+i], 'g', -1, 64))
+			}
+		}
+	}
+}
+
+// Writes legacy VTK structured points in camera coordinates: x to the right, y up and z into the screen, in units of
+// bohr radius with the origin at the center of the middle layer. With perspective projection the layers are actually
+// scaled with their distance from the camera, which this ignores.
+func writeVTK(w *bufio.Writer, cfg *Config, data []float64, layers int) {
+	size := cfg.ImageSize
+	step := cfg.viewSize() / float64(size-1)
+	fmt.Fprintf(w, "# vtk DataFile Version 3.0\n")
+	fmt.Fprintf(w, "hydrogen probability density\n")
+	fmt.Fprintf(w, "BINARY\n")
+	fmt.Fprintf(w, "DATASET STRUCTURED_POINTS\n")
+	fmt.Fprintf(w, "DIMENSIONS %v %v %v\n", size, size, layers)
+	half := cfg.viewSize() / 2
+	fmt.Fprintf(w, "ORIGIN %v %v %v\n", -half, -half, float64(-(layers-1)/2)*cfg.LayerDist.Value)
+	fmt.Fprintf(w, "SPACING %v %v %v\n", step, step, cfg.LayerDist.Value)
+	fmt.Fprintf(w, "POINT_DATA %v\n", size*size*layers)
+	fmt.Fprintf(w, "SCALARS density double 1\n")
+	fmt.Fprintf(w, "LOOKUP_TABLE default\n")
+	// VTK binary data is big-endian, with x varying fastest, then y upwards, i.e., image rows bottom to top.
+	buf := make([]byte, 8)
+	for k := 0; k < layers; k++ {
+		for j := size - 1; j >= 0; j-- {
+			for i := 0; i < size; i++ {
+				binary.BigEndian.PutUint64(buf, math.Float64bits(data[k*size*size+j*size+i]))
+				w.Write(buf)
+			}
+		}
+	}
+	w.WriteByte('\n')
+}
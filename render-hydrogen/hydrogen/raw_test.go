@@ -0,0 +1,172 @@
+package hydrogen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Parses the CSV written by writeCSV.
+func readCSV(t *testing.T, b []byte, size, layers int) []float64 {
+	t.Helper()
+	data := make([]float64, size*size*layers)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if layers == 1 {
+		if len(lines) != size {
+			t.Fatalf("%v rows, expecting %v", len(lines), size)
+		}
+		for j, line := range lines {
+			values := strings.Split(line, ",")
+			if len(values) != size {
+				t.Fatalf("row %v has %v values, expecting %v", j, len(values), size)
+			}
+			for i, v := range values {
+				var err error
+				if data[j*size+i], err = strconv.ParseFloat(v, 64); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return data
+	}
+	if lines[0] != "layer,row,column,density" || len(lines) != len(data)+1 {
+		t.Fatalf("unexpected header %q or %v lines", lines[0], len(lines))
+	}
+	for _, line := range lines[1:] {
+		var k, j, i int
+		var v float64
+		if _, err := fmt.Sscanf(line, "%d,%d,%d,%g", &k, &j, &i, &v); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		data[k*size*size+j*size+i] = v
+	}
+	return data
+}
+
+// Parses the VTK written by writeVTK.
+func readVTK(t *testing.T, b []byte, size, layers int) []float64 {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(b))
+	header := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if key, value, ok := strings.Cut(line, " "); ok {
+			header[key] = value
+		}
+		if line == "LOOKUP_TABLE default" {
+			break
+		}
+	}
+	if dims := fmt.Sprintf("%v %v %v", size, size, layers); header["DIMENSIONS"] != dims {
+		t.Fatalf("DIMENSIONS %v, expecting %v", header["DIMENSIONS"], dims)
+	}
+	if header["SCALARS"] != "density double 1" {
+		t.Fatalf("SCALARS %v", header["SCALARS"])
+	}
+	data := make([]float64, size*size*layers)
+	for k := 0; k < layers; k++ {
+		// Rows bottom to top.
+		for j := size - 1; j >= 0; j-- {
+			for i := 0; i < size; i++ {
+				var bits uint64
+				if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+					t.Fatal(err)
+				}
+				data[k*size*size+j*size+i] = math.Float64frombits(bits)
+			}
+		}
+	}
+	if rest, _ := r.ReadString(0); rest != "\n" {
+		t.Fatalf("%v trailing bytes", len(rest))
+	}
+	return data
+}
+
+func TestRawRoundTrip(t *testing.T) {
+	cfg := testConfig(t, map[string]interface{}{"imageSize": 6})
+	rng := rand.New(rand.NewSource(1))
+	dir := t.TempDir()
+	for _, layers := range []int{1, cfg.Layers} {
+		// Values over the whole range of the density, including zero and subnormals.
+		data := make([]float64, cfg.ImageSize*cfg.ImageSize*layers)
+		for p := range data {
+			data[p] = rng.Float64() * math.Pow(10, float64(rng.Intn(600)-300))
+		}
+		data[0], data[1] = 0, math.SmallestNonzeroFloat64
+		for _, format := range []string{"npy", "csv", "vtk"} {
+			t.Run(fmt.Sprintf("%v-%v", format, layers), func(t *testing.T) {
+				filename := filepath.Join(dir, fmt.Sprintf("raw-%v.%v", layers, format))
+				if err := writeRawFile(cfg, filename, format, data, layers); err != nil {
+					t.Fatal(err)
+				}
+				b, err := os.ReadFile(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []float64
+				switch format {
+				case "npy":
+					var shape []int
+					if shape, got, err = readNPY(filename); err != nil {
+						t.Fatal(err)
+					}
+					want := []int{cfg.ImageSize, cfg.ImageSize}
+					if layers > 1 {
+						want = append([]int{layers}, want...)
+					}
+					if fmt.Sprint(shape) != fmt.Sprint(want) {
+						t.Errorf("shape %v, expecting %v", shape, want)
+					}
+					// The data is 64-byte aligned.
+					if offset := len(b) - 8*len(data); offset%64 != 0 {
+						t.Errorf("data at offset %v", offset)
+					}
+				case "csv":
+					got = readCSV(t, b, cfg.ImageSize, layers)
+				case "vtk":
+					got = readVTK(t, b, cfg.ImageSize, layers)
+				}
+				if len(got) != len(data) {
+					t.Fatalf("%v values, expecting %v", len(got), len(data))
+				}
+				for p := range data {
+					if got[p] != data[p] {
+						t.Fatalf("value %v is %v, expecting %v", p, got[p], data[p])
+					}
+				}
+			})
+		}
+	}
+}
+
+// Shapes that are not positive or do not match the length of the data are rejected before allocating.
+func TestReadNPYInvalidShape(t *testing.T) {
+	dir := t.TempDir()
+	for k, shape := range []string{"-1, 5", "0, 4", "2, 3", "4294967296, 4294967296, 1024", "abc"} {
+		header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%v), }\n", shape)
+		var b bytes.Buffer
+		b.WriteString("\x93NUMPY\x01\x00")
+		binary.Write(&b, binary.LittleEndian, uint16(len(header)))
+		b.WriteString(header)
+		binary.Write(&b, binary.LittleEndian, make([]float64, 5))
+		filename := filepath.Join(dir, fmt.Sprintf("shape-%v.npy", k))
+		if err := os.WriteFile(filename, b.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := readNPY(filename); err == nil {
+			t.Errorf("shape (%v) of 5 values accepted", shape)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package hydrogen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Colors the raw density saved by a previous render, and writes it to cfg.OutputFile. The layers of a volume are
+// composited the same way as the render does, see compositeLayers().
+func recolor(cfg *Config, filename string) error {
+	// Only the density is saved, not the amplitudes.
+	if cfg.ColorMode != densityColorMode {
+		return fieldError("colorMode",
+			fmt.Sprintf("invalid colorMode: %v cannot be recolored, only the density is saved", cfg.ColorMode))
+	}
+	shape, data, err := readNPY(filename)
+	if err != nil {
+		return err
+	}
+	if (len(shape) != 2 && len(shape) != 3) || shape[len(shape)-2] < 2 || shape[len(shape)-1] < 2 {
+		return fmt.Errorf("unexpected shape %v of %v", shape, filename)
+	}
+	h, w := shape[len(shape)-2], shape[len(shape)-1]
+	// The annotation is laid out for the image size of the config.
+	if cfg.Annotate && (w != cfg.ImageSize || h != cfg.ImageSize) {
+		return fmt.Errorf("%v is %vx%v pixels, annotate requires imageSize %v", filename, w, h, cfg.ImageSize)
+	}
+	composited := data
+	if len(shape) == 3 {
+		if shape[0] != cfg.Layers {
+			return fmt.Errorf("%v has %v layers, the config %v", filename, shape[0], cfg.Layers)
+		}
+		composited = compositeLayers(cfg, data, w, h)
+	}
+
+	max := 0.0
+	for _, d := range composited {
+		if d > max {
+			max = d
+		}
+	}
+	if cfg.Normalization == absoluteNormalization {
+		max, _ = cfg.normalizationScale(nil).Float64()
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			// A zero max leaves all pixels at zero, like colorize().
+			normalized := 0.0
+			if max > 0 {
+				normalized = composited[j*w+i] / max
+			}
+			img.SetRGBA64(i, j, cfg.heatmapColor(cfg.toneMap(normalized)))
+		}
+	}
+	if cfg.Annotate {
+		img = annotate(cfg, img, cfg.physicalDensity(newFromFloat64(cfg.FloatPrec, max)), cfg.CameraPhi, 0)
+	}
+	return writePNG(cfg.OutputFile, img)
+}
+
+// Composites the layers volume of w x h pixels, nearest layer first, with the compositing of the config. Emission
+// takes the opacity relative to the max over the same grid of pixels as referenceDensity(), so a still image is
+// recolored as rendered.
+func compositeLayers(cfg *Config, data []float64, w, h int) []float64 {
+	composited := make([]float64, w*h)
+	switch cfg.Compositing {
+	case sumCompositing:
+		for p, d := range data {
+			composited[p%(w*h)] += d
+		}
+	case sliceCompositing:
+		copy(composited, data[(cfg.SliceLayer+(cfg.Layers-1)/2)*w*h:])
+	case mipCompositing:
+		for p, d := range data {
+			if d > composited[p%(w*h)] {
+				composited[p%(w*h)] = d
+			}
+		}
+	case emissionCompositing:
+		reference := 0.0
+		for a := 0; a < referenceGridSize && a < w; a++ {
+			i := a * (w - 1) / (minInt(referenceGridSize, w) - 1)
+			for b := 0; b < referenceGridSize && b < h; b++ {
+				j := b * (h - 1) / (minInt(referenceGridSize, h) - 1)
+				for k := 0; k < cfg.Layers; k++ {
+					reference = math.Max(reference, data[k*w*h+j*w+i])
+				}
+			}
+		}
+		for p := range composited {
+			transmittance := 1.0
+			for k := 0; k < cfg.Layers; k++ {
+				density := data[k*w*h+p]
+				opacity := 0.0
+				if reference > 0 {
+					opacity = cfg.opacityAt(density / reference)
+				}
+				composited[p] += transmittance * opacity * density
+				transmittance *= 1 - opacity
+			}
+		}
+	}
+	return composited
+}
+
+var npyShapeRE = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+
+// Reads the little-endian float64 C-order array written by writeNPY(), returns the shape and the data.
+func readNPY(filename string) ([]int, []float64, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) < 10 || string(b[:6]) != "\x93NUMPY" {
+		return nil, nil, fmt.Errorf("not a .npy file: %v", filename)
+	}
+	// Version 1.0 has a 2-byte header length, later versions 4-byte.
+	start, headerLen := 10, int(binary.LittleEndian.Uint16(b[8:10]))
+	if b[6] > 1 {
+		start, headerLen = 12, int(binary.LittleEndian.Uint32(b[8:12]))
+	}
+	if start+headerLen > len(b) {
+		return nil, nil, fmt.Errorf("truncated .npy header: %v", filename)
+	}
+	header := string(b[start : start+headerLen])
+	if !strings.Contains(header, "'descr': '<f8'") || !strings.Contains(header, "'fortran_order': False") {
+		return nil, nil, fmt.Errorf("unsupported .npy header: %v", header)
+	}
+	match := npyShapeRE.FindStringSubmatch(header)
+	if match == nil {
+		return nil, nil, fmt.Errorf("missing shape in .npy header: %v", header)
+	}
+	// The shape is checked against the length of the data before allocating, so that the product cannot overflow.
+	payload := b[start+headerLen:]
+	mismatch := fmt.Errorf("shape %v does not match the %v bytes of data of %v", match[1], len(payload), filename)
+	var shape []int
+	cnt := 1
+	for _, dim := range strings.Split(match[1], ",") {
+		if dim = strings.TrimSpace(dim); dim == "" {
+			continue
+		}
+		v, err := strconv.Atoi(dim)
+		if err != nil || v <= 0 {
+			return nil, nil, fmt.Errorf("invalid shape in .npy header: %v", header)
+		}
+		shape = append(shape, v)
+		if cnt > len(payload)/8/v {
+			return nil, nil, mismatch
+		}
+		cnt *= v
+	}
+	if cnt*8 != len(payload) {
+		return nil, nil, mismatch
+	}
+	data := make([]float64, cnt)
+	if err := binary.Read(bytes.NewReader(payload), binary.LittleEndian, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to read .npy data: %w", err)
+	}
+	return shape, data, nil
+}
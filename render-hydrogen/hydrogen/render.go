@@ -0,0 +1,551 @@
+package hydrogen
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rendered data of one frame.
+type frame struct {
+	// Data with the layers composited.
+	data []*big.Float
+	// Amplitudes with the layers composited the same way, only needed for phase coloring.
+	amps []complexFloat
+	// Density of each layer, indexed by k*ImageSize^2+j*ImageSize+i with k counted from the nearest layer, only
+	// needed for the raw per-layer output.
+	layers []float64
+}
+
+// Rendered data of one pixel for all frames.
+type pixelResult struct {
+	data []*big.Float
+	// Nil unless phase coloring.
+	amps []complexFloat
+	// Indexed by frame then by layer, nil unless needed for the raw per-layer output.
+	layers [][]float64
+	// Whether any point needed escalation to big.Float.
+	escalated bool
+}
+
+// Renders the frames of each view at the given times, indexed by v*len(times)+t. The wavefunction is evaluated only
+// once per point of each view, and each time combines the energy components with its own phases.
+type renderer struct {
+	cfg *Config
+	// Camera of each view, e.g., the eyes of a stereo pair or the steps of a turntable.
+	views []*screen
+	eval  *evaluator
+	// If not nil, points are evaluated in float64 first.
+	fe *fastEvaluator
+	// Whether points are evaluated in float64 only, never escalating to big.Float, for the preview.
+	fastOnly bool
+	times    []float64
+	phases   [][]complexFloat
+	// Samples per pixel along each axis, 1 for the first pass of adaptive supersampling.
+	samples int
+	// Max density over a coarse sampling of all layers and frames, which the opacity transfer function is relative to.
+	// Only set for emission compositing.
+	reference *big.Float
+}
+
+// Side length in pixels of the coarse grid sampled for renderer.reference.
+const referenceGridSize = 64
+
+func newRenderer(cfg *Config, times []float64) (*renderer, error) {
+	rd := &renderer{
+		cfg:     cfg,
+		eval:    newEvaluator(cfg),
+		times:   times,
+		phases:  make([][]complexFloat, len(times)),
+		samples: cfg.Supersampling,
+	}
+	if cfg.AdaptiveThreshold > 0 {
+		rd.samples = 1
+	}
+	for _, v := range cfg.views() {
+		rd.views = append(rd.views, newScreen(cfg, v))
+	}
+	if cfg.Evaluation == autoEvaluation {
+		rd.fe = newFastEvaluator(rd.eval)
+	}
+	for f, t := range times {
+		rd.phases[f] = rd.eval.phasesAt(t)
+	}
+	if cfg.Compositing == emissionCompositing {
+		reference, err := rd.referenceDensity()
+		if err != nil {
+			return nil, err
+		}
+		rd.reference = reference
+	}
+	return rd, nil
+}
+
+// Returns the number of frames.
+func (rd *renderer) frameCount() int {
+	return len(rd.views) * len(rd.times)
+}
+
+// Returns the layers evaluated for each pixel, nearest first.
+func (rd *renderer) layerIndices() []int {
+	if rd.cfg.Compositing == sliceCompositing {
+		return []int{rd.cfg.SliceLayer}
+	}
+	// Recall cfg.Layers must be odd number
+	halfLayers := (rd.cfg.Layers - 1) / 2
+	ks := make([]int, 0, rd.cfg.Layers)
+	for k := -halfLayers; k <= halfLayers; k++ {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+// Evaluates the energy components at grid point (i,j,k) of the view, and reports whether it needed escalation to
+// big.Float.
+func (rd *renderer) point(scr *screen, i, j float64, k int) ([]complexFloat, bool) {
+	r := scr.gridToWorld(i, j, k)
+	if rd.fe != nil {
+		x, _ := r[0].Float64()
+		y, _ := r[1].Float64()
+		z, _ := r[2].Float64()
+		if comps, ok := rd.fe.components(x, y, z); ok || rd.fastOnly {
+			return comps, false
+		}
+	}
+	return rd.eval.components(r[0], r[1], r[2]), rd.fe != nil
+}
+
+// Returns the max density over all layers and frames of a grid of referenceGridSize^2 pixels spread over the image.
+// The grid only depends on the config, so distributed workers agree on the result.
+func (rd *renderer) referenceDensity() (*big.Float, error) {
+	size := referenceGridSize
+	if rd.cfg.ImageSize < size {
+		size = rd.cfg.ImageSize
+	}
+	maxes := make([]*big.Float, rd.cfg.Concurrency)
+	var wg sync.WaitGroup
+	wg.Add(rd.cfg.Concurrency)
+	for w := 0; w < rd.cfg.Concurrency; w++ {
+		go func(shard int) {
+			defer wg.Done()
+			maxes[shard] = blankFloat(rd.eval.prec)
+			for a := shard; a < size; a += rd.cfg.Concurrency {
+				i := a * (rd.cfg.ImageSize - 1) / (size - 1)
+				for b := 0; b < size; b++ {
+					j := b * (rd.cfg.ImageSize - 1) / (size - 1)
+					for _, scr := range rd.views {
+						for _, k := range rd.layerIndices() {
+							comps, _ := rd.point(scr, float64(i), float64(j), k)
+							for t := range rd.times {
+								density := rd.eval.evolve(comps, rd.phases[t]).abs2()
+								if maxes[shard].Cmp(density) < 0 {
+									maxes[shard].Set(density)
+								}
+							}
+						}
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	ans := blankFloat(rd.eval.prec)
+	for _, m := range maxes {
+		if ans.Cmp(m) < 0 {
+			ans.Set(m)
+		}
+	}
+	if ans.Sign() == 0 {
+		return nil, errors.New("the sampled density is zero everywhere, nothing to composite")
+	}
+	return ans, nil
+}
+
+// Allocates the data of all frames.
+func (rd *renderer) newFrames() []*frame {
+	frames := make([]*frame, rd.frameCount())
+	for f := range frames {
+		frames[f] = &frame{data: make([]*big.Float, rd.cfg.ImageSize*rd.cfg.ImageSize)}
+		if rd.cfg.keepAmps() {
+			frames[f].amps = make([]complexFloat, rd.cfg.ImageSize*rd.cfg.ImageSize)
+		}
+		if rd.cfg.keepLayers() {
+			frames[f].layers = make([]float64, rd.cfg.Layers*rd.cfg.ImageSize*rd.cfg.ImageSize)
+		}
+	}
+	return frames
+}
+
+// Stores pixel (i,j) into the frames, safe for concurrent use as long as no two goroutines store the same pixel.
+func (rd *renderer) store(frames []*frame, i, j int, px *pixelResult) {
+	size := rd.cfg.ImageSize
+	for f, fr := range frames {
+		fr.data[j*size+i] = px.data[f]
+		if fr.amps != nil {
+			fr.amps[j*size+i] = px.amps[f]
+		}
+		if fr.layers != nil {
+			for k, d := range px.layers[f] {
+				fr.layers[k*size*size+j*size+i] = d
+			}
+		}
+	}
+}
+
+// Computes pixel (i,j) of all frames with rd.samples^2 samples. Sends to progress after each layer of each sample if
+// not nil.
+func (rd *renderer) pixel(i, j int, progress chan<- struct{}) *pixelResult {
+	return rd.supersample(i, j, rd.samples, progress)
+}
+
+// Computes pixel (i,j) of all frames as the average of samples x samples samples, one in each cell of the grid
+// dividing the pixel, jittered within the cell. A single sample is taken at the pixel center.
+func (rd *renderer) supersample(i, j, samples int, progress chan<- struct{}) *pixelResult {
+	if samples == 1 {
+		return rd.sample(float64(i), float64(j), progress)
+	}
+	var px *pixelResult
+	for s := 0; s < samples*samples; s++ {
+		// The jitter only depends on the pixel and the sample, so that the render is reproducible.
+		jx, jy := jitter(i, j, s)
+		x := float64(i) - 0.5 + (float64(s%samples)+jx)/float64(samples)
+		y := float64(j) - 0.5 + (float64(s/samples)+jy)/float64(samples)
+		spx := rd.sample(x, y, progress)
+		if px == nil {
+			px = spx
+			continue
+		}
+		px.escalated = px.escalated || spx.escalated
+		for f := range px.data {
+			px.data[f].Add(px.data[f], spx.data[f])
+			if px.amps != nil {
+				px.amps[f].add(px.amps[f], spx.amps[f])
+			}
+			if px.layers != nil {
+				for k, d := range spx.layers[f] {
+					px.layers[f][k] += d
+				}
+			}
+		}
+	}
+	count := float64(samples * samples)
+	inv := newFromFloat64(rd.eval.prec, 1/count)
+	for f := range px.data {
+		px.data[f].Mul(px.data[f], inv)
+		if px.amps != nil {
+			px.amps[f].scale(px.amps[f], inv)
+		}
+		if px.layers != nil {
+			for k := range px.layers[f] {
+				px.layers[f][k] /= count
+			}
+		}
+	}
+	return px
+}
+
+// Returns pseudo-random offsets in [0,1) for sample s of pixel (i,j), using the SplitMix64 mixing function.
+func jitter(i, j, s int) (float64, float64) {
+	h := uint64(i)<<42 ^ uint64(j)<<21 ^ uint64(s)
+	mix := func() float64 {
+		h += 0x9e3779b97f4a7c15
+		z := h
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		z ^= z >> 31
+		return float64(z>>11) / (1 << 53)
+	}
+	x := mix()
+	return x, mix()
+}
+
+// Computes the sample at the fractional pixel coordinates (x,y) of all frames. Sends to progress after each layer if
+// not nil.
+func (rd *renderer) sample(x, y float64, progress chan<- struct{}) *pixelResult {
+	frames := rd.frameCount()
+	px := &pixelResult{data: make([]*big.Float, frames)}
+	if rd.cfg.keepAmps() {
+		px.amps = make([]complexFloat, frames)
+	}
+	if rd.cfg.keepLayers() {
+		px.layers = make([][]float64, frames)
+	}
+	for f := 0; f < frames; f++ {
+		px.data[f] = blankFloat(rd.eval.prec)
+		if px.amps != nil {
+			px.amps[f] = blankComplex(rd.eval.prec)
+		}
+		if px.layers != nil {
+			// Layers not evaluated by slice compositing are left zero.
+			px.layers[f] = make([]float64, rd.cfg.Layers)
+		}
+	}
+	// Fraction of light from behind passing through the layers so far, for emission compositing.
+	transmittance := make([]float64, frames)
+	for f := range transmittance {
+		transmittance[f] = 1
+	}
+	halfLayers := (rd.cfg.Layers - 1) / 2
+	for v, scr := range rd.views {
+		for _, k := range rd.layerIndices() {
+			comps, escalated := rd.point(scr, x, y, k)
+			px.escalated = px.escalated || escalated
+			for t := range rd.times {
+				f := v*len(rd.times) + t
+				psi := rd.eval.evolve(comps, rd.phases[t])
+				density := psi.abs2()
+				switch rd.cfg.Compositing {
+				case sumCompositing, sliceCompositing:
+					px.data[f].Add(px.data[f], density)
+					if px.amps != nil {
+						px.amps[f].add(px.amps[f], psi)
+					}
+				case emissionCompositing:
+					// Front to back, each layer emits its density and absorbs the given opacity of what lies behind.
+					relative, _ := new(big.Float).Quo(density, rd.reference).Float64()
+					opacity := rd.cfg.opacityAt(relative)
+					weight := newFromFloat64(rd.eval.prec, transmittance[f]*opacity)
+					px.data[f].Add(px.data[f], new(big.Float).Mul(density, weight))
+					if px.amps != nil {
+						px.amps[f].add(px.amps[f], blankComplex(rd.eval.prec).scale(psi, weight))
+					}
+					transmittance[f] *= 1 - opacity
+				case mipCompositing:
+					if px.data[f].Cmp(density) < 0 {
+						px.data[f].Set(density)
+						if px.amps != nil {
+							px.amps[f] = psi
+						}
+					}
+				}
+				if px.layers != nil {
+					px.layers[f][k+halfLayers], _ = density.Float64()
+				}
+			}
+			if progress != nil {
+				progress <- struct{}{}
+			}
+		}
+	}
+	return px
+}
+
+// Starts the goroutine displaying the percentage progress out of total ticks on the log of cfg, wg is done once all
+// ticks are received.
+func showProgress(cfg *Config, total int, wg *sync.WaitGroup) chan<- struct{} {
+	ch := make(chan struct{}, 256)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logf := cfg.logf
+		if cfg.quiet {
+			logf = func(string, ...interface{}) {}
+		}
+		mark := 0
+		cnt := 0
+		for cnt < total {
+			if _, ok := <-ch; !ok {
+				// Stopped before all ticks.
+				logf("\n")
+				return
+			}
+			cnt++
+			progress := int(1000.0 * float64(cnt) / float64(total))
+			if progress > mark {
+				mark = progress
+				logf("\r       \r%03.1f%%", float64(progress)/10.0)
+			}
+		}
+		logf("\r       \rdone\n")
+	}()
+	return ch
+}
+
+// Renders all frames locally, and returns the number of pixels where any point needed escalation to big.Float. If ckpt
+// is not nil, the columns it loaded are not computed again, and every newly completed column is written to it. Stops
+// early with the error once ctx is done or the checkpoint fails.
+func (rd *renderer) render(ctx context.Context, ckpt *checkpoint) ([]*frame, int, error) {
+	cfg := rd.cfg
+	frames := rd.newFrames()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var escalated int64
+	// Stores the completed column into the frames.
+	store := func(col *column) {
+		for j, px := range col.pixels {
+			rd.store(frames, col.i, j, px)
+		}
+		atomic.AddInt64(&escalated, int64(col.escalated()))
+	}
+	remaining := cfg.ImageSize
+	if ckpt != nil {
+		for _, col := range ckpt.loaded {
+			store(col)
+			remaining--
+		}
+		// Periodically persist the columns written to the checkpoint.
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.CheckpointInterval) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := ckpt.flush(); err != nil {
+						cancel()
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var wg, progressWg sync.WaitGroup
+	total := remaining * cfg.ImageSize * rd.samples * rd.samples * len(rd.views) * len(rd.layerIndices())
+	ch := showProgress(cfg, total, &progressWg)
+
+	// One goroutine per worker, with all workers partitioning the i-index space.
+	wg.Add(cfg.Concurrency)
+	for w := 0; w < cfg.Concurrency; w++ {
+		go func(shard int) {
+			defer wg.Done()
+			for i := 0; i < cfg.ImageSize; i++ {
+				if i%cfg.Concurrency != shard {
+					continue
+				}
+				if ckpt != nil && ckpt.loaded[i] != nil {
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				col := &column{i: i, pixels: make([]*pixelResult, cfg.ImageSize)}
+				for j := 0; j < cfg.ImageSize; j++ {
+					col.pixels[j] = rd.pixel(i, j, ch)
+				}
+				store(col)
+				if ckpt != nil {
+					if err := ckpt.write(col); err != nil {
+						cancel()
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(ch)
+	progressWg.Wait()
+	if ckpt != nil && ckpt.failed() != nil {
+		return nil, 0, ckpt.failed()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return frames, int(escalated), nil
+}
+
+// Returns the max density over all pixels of all frames.
+func maxDensity(frames []*frame) *big.Float {
+	max := new(big.Float)
+	for _, fr := range frames {
+		for i := 0; i < len(fr.data); i++ {
+			if max.Cmp(fr.data[i]) < 0 {
+				max.Set(fr.data[i])
+			}
+		}
+	}
+	return max
+}
+
+// Returns the max of |Re psi| over all pixels of all frames.
+func maxRealPart(frames []*frame) *big.Float {
+	max := new(big.Float)
+	for _, fr := range frames {
+		for _, amp := range fr.amps {
+			if abs := new(big.Float).Abs(amp.re); max.Cmp(abs) < 0 {
+				max.Set(abs)
+			}
+		}
+	}
+	return max
+}
+
+// Renders again with cfg.Supersampling the pixels whose position on the heatmap differs by more than
+// cfg.AdaptiveThreshold from any of their 4 neighbors in any frame. Returns the number of refined pixels, and the
+// number of those where any point needed escalation to big.Float, or ctx.Err() once ctx is done.
+func (rd *renderer) refine(ctx context.Context, frames []*frame) (int, int, error) {
+	cfg := rd.cfg
+	size := cfg.ImageSize
+	max := cfg.normalizationScale(maxDensity(frames))
+	tones := make([][]float64, len(frames))
+	for f, fr := range frames {
+		tones[f] = make([]float64, len(fr.data))
+		for p, d := range fr.data {
+			normalized, _ := new(big.Float).Quo(d, max).Float64()
+			tones[f][p] = cfg.toneMap(normalized)
+		}
+	}
+	var pixels []int
+	for p := 0; p < size*size; p++ {
+		i, j := p%size, p/size
+		var neighbors []int
+		if i > 0 {
+			neighbors = append(neighbors, p-1)
+		}
+		if i+1 < size {
+			neighbors = append(neighbors, p+1)
+		}
+		if j > 0 {
+			neighbors = append(neighbors, p-size)
+		}
+		if j+1 < size {
+			neighbors = append(neighbors, p+size)
+		}
+	search:
+		for _, tone := range tones {
+			for _, q := range neighbors {
+				if math.Abs(tone[p]-tone[q]) > cfg.AdaptiveThreshold {
+					pixels = append(pixels, p)
+					break search
+				}
+			}
+		}
+	}
+	samples := cfg.Supersampling
+	cfg.logf("refining %v of %v pixels with %vx%v samples\n", len(pixels), size*size, samples, samples)
+
+	var wg, progressWg sync.WaitGroup
+	ch := showProgress(cfg, len(pixels)*samples*samples*len(rd.views)*len(rd.layerIndices()), &progressWg)
+	var escalated int64
+	wg.Add(cfg.Concurrency)
+	for w := 0; w < cfg.Concurrency; w++ {
+		go func(shard int) {
+			defer wg.Done()
+			for n := shard; n < len(pixels); n += cfg.Concurrency {
+				if ctx.Err() != nil {
+					return
+				}
+				i, j := pixels[n]%size, pixels[n]/size
+				px := rd.supersample(i, j, samples, ch)
+				rd.store(frames, i, j, px)
+				if px.escalated {
+					atomic.AddInt64(&escalated, 1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ch)
+	progressWg.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	return len(pixels), int(escalated), nil
+}
@@ -0,0 +1,141 @@
+package hydrogen
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Options of Run, mirroring the flags of the render-hydrogen command.
+type Options struct {
+	// Resume from the checkpoint file of the config, only computing the missing columns.
+	Resume bool
+	// If set, listen on this address and farm out tiles to workers instead of rendering locally.
+	Coordinator string
+	// If set, render tiles for the coordinator at this address, with the same config.
+	Worker string
+	// If set, recolor the raw density from this .npy file with the heatmap, exposure, scale and clipping of the config,
+	// without rendering.
+	Recolor string
+	// Write the isosurface mesh configured by the isosurface section instead of rendering.
+	Mesh bool
+	// Write the point cloud configured by the pointCloud section instead of rendering, sampled with Seed, 0 for a
+	// random seed.
+	Points bool
+	Seed   int64
+	// Write the preview configured by the preview section, or the default preview without one, instead of rendering.
+	Preview bool
+}
+
+// Run validates and renders the config and writes all configured outputs, or does what opts asks for instead, like the
+// render-hydrogen command, leaving the config unchanged. Renders stop with ctx.Err() once ctx is done, after persisting
+// the checkpoint of a local render.
+func Run(ctx context.Context, cfg *Config, opts Options) error {
+	cfg, err := cfg.validated()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Sweep != nil {
+		if opts.Mesh || opts.Points || opts.Coordinator != "" || opts.Worker != "" || opts.Resume ||
+			opts.Recolor != "" || opts.Preview {
+			return errors.New("sweep is rendered locally, " +
+				"without -mesh, -points, -coordinator, -worker, -resume, -recolor or -preview")
+		}
+		return runSweep(ctx, cfg)
+	}
+	if opts.Preview && cfg.Preview == nil {
+		// The preview with the defaults, without changing the caller's config.
+		pv := &Preview{}
+		if err := cfg.validatePreview(pv); err != nil {
+			return err
+		}
+		previewCfg := *cfg
+		previewCfg.Preview = pv
+		cfg = &previewCfg
+	}
+	if err := cfg.resolveAuto(); err != nil {
+		return err
+	}
+
+	if opts.Recolor != "" {
+		return recolor(cfg, opts.Recolor)
+	}
+
+	// A still image is the single frame at t=0.
+	times := []float64{0}
+	if cfg.Animation != nil {
+		times = cfg.Animation.times()
+	}
+	rd, err := newRenderer(cfg, times)
+	if err != nil {
+		return err
+	}
+
+	if opts.Mesh {
+		if cfg.Isosurface == nil {
+			return errors.New("-mesh requires isosurface in the config")
+		}
+		return exportMesh(ctx, rd)
+	}
+	if opts.Points {
+		if cfg.PointCloud == nil {
+			return errors.New("-points requires pointCloud in the config")
+		}
+		seed := opts.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		return exportPointCloud(ctx, rd, seed)
+	}
+	// The preview helps to abort a bad framing before the full render, which then reuses the evaluator.
+	if cfg.Preview != nil && opts.Worker == "" {
+		if err := renderPreview(ctx, rd); err != nil {
+			return err
+		}
+		if opts.Preview {
+			return nil
+		}
+	}
+	if len(cfg.Panels) > 0 {
+		if opts.Coordinator != "" || opts.Worker != "" || opts.Resume {
+			return errors.New("panels are rendered locally, without -coordinator, -worker or -resume")
+		}
+		imgs, _, err := renderPanels(ctx, rd)
+		if err != nil {
+			return err
+		}
+		return writeImages(cfg, imgs)
+	}
+	if (opts.Coordinator != "" || opts.Worker != "") && (opts.Resume || cfg.CheckpointFile != "") {
+		return errors.New("distributed renders are not checkpointed, without -resume or checkpointFile")
+	}
+	if opts.Worker != "" {
+		return work(ctx, rd, opts.Worker)
+	}
+
+	var frames []*frame
+	var escalated int
+	if opts.Coordinator != "" {
+		frames, escalated, err = coordinate(ctx, rd, opts.Coordinator)
+	} else {
+		var ckpt *checkpoint
+		if cfg.CheckpointFile != "" {
+			if ckpt, err = openCheckpoint(cfg, rd.frameCount(), opts.Resume); err != nil {
+				return err
+			}
+		} else if opts.Resume {
+			return errors.New("-resume requires checkpointFile in the config")
+		}
+		frames, escalated, err = rd.render(ctx, ckpt)
+		if ckpt != nil {
+			if closeErr := ckpt.close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return rd.finish(ctx, frames, escalated)
+}
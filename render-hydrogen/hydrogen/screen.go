@@ -0,0 +1,145 @@
+package hydrogen
+
+import (
+	"math"
+	"math/big"
+)
+
+// Calculates screen to world geometry.
+type screen struct {
+	// Normalized "in" vector from center-of-screen to the look-at point, in world coordinates.
+	in [3]*big.Float
+	// Normalized "up" vector of screen, in world coordinates.
+	up [3]*big.Float
+	// Normalized "right" vector of screen, in world coordinates.
+	right [3]*big.Float
+	// Middle layer's northwest corner pixel, in world coordinate.
+	nw [3]*big.Float
+	// Steps in world measurement to the right/up/in direction respectively.
+	step [3]*big.Float
+	// Camera position in world coordinates and its distance to the middle layer, for perspective projection only.
+	eye  [3]*big.Float
+	dist *big.Float
+	// Precision of the big.Float arithmetic in bits.
+	prec uint
+}
+
+func newScreen(cfg *Config, v view) *screen {
+	ct, st := math.Cos(cfg.CameraTheta), math.Sin(cfg.CameraTheta)
+	cp, sp := math.Cos(v.phi), math.Sin(v.phi)
+	// The roll rotates the up and right vectors around the in vector.
+	cr, sr := math.Cos(cfg.CameraRoll), math.Sin(cfg.CameraRoll)
+	in := [3]float64{-st * cp, -st * sp, -ct}
+	up := [3]float64{-ct * cp, -ct * sp, st}
+	right := [3]float64{-sp, cp, 0}
+	// The yaw then rotates the in and right vectors around the up vector, turning the camera around lookAt.
+	cy, sy := math.Cos(v.yaw), math.Sin(v.yaw)
+	for n := 0; n < 3; n++ {
+		up[n], right[n] = cr*up[n]-sr*right[n], cr*right[n]+sr*up[n]
+	}
+	for n := 0; n < 3; n++ {
+		in[n], right[n] = cy*in[n]+sy*right[n], cy*right[n]-sy*in[n]
+	}
+
+	prec := cfg.FloatPrec
+	pixelStep := newFromFloat64(prec, cfg.viewSize()/float64(cfg.ImageSize-1))
+	scr := &screen{
+		prec: prec,
+		step: [3]*big.Float{
+			pixelStep,
+			pixelStep,
+			newFromFloat64(prec, cfg.LayerDist.Value),
+		},
+	}
+	for n := 0; n < 3; n++ {
+		scr.in[n] = newFromFloat64(prec, in[n])
+		scr.up[n] = newFromFloat64(prec, up[n])
+		scr.right[n] = newFromFloat64(prec, right[n])
+	}
+	hs := newFromFloat64(prec, cfg.viewSize()*0.5)
+	for n := 0; n < 3; n++ {
+		scr.nw[n] = blankFloat(prec).Mul(hs, blankFloat(prec).Sub(scr.up[n], scr.right[n]))
+		scr.nw[n].Add(scr.nw[n], newFromFloat64(prec, cfg.LookAt[n]))
+	}
+	if cfg.Projection == perspectiveProjection {
+		scr.dist = newFromFloat64(prec, cfg.CameraDistance)
+		for n := 0; n < 3; n++ {
+			scr.eye[n] = blankFloat(prec).Mul(scr.dist, scr.in[n])
+			scr.eye[n].Sub(newFromFloat64(prec, cfg.LookAt[n]), scr.eye[n])
+		}
+	}
+
+	return scr
+}
+
+// Computes world coordinates given grid coordinate (i,j,k), where (i,j) is the x-y pixel coordinate, fractional for
+// sub-pixel samples, and k is the layer index (middle layer contains the look-at point). In perspective projection, the
+// point is where the ray from the camera through pixel (i,j) of the middle layer crosses layer k.
+func (scr *screen) gridToWorld(i, j float64, k int) [3]*big.Float {
+	ret := [3]*big.Float{}
+	for n := 0; n < 3; n++ {
+		ret[n] = blankFloat(scr.prec).Set(scr.nw[n])
+
+		right := newFromFloat64(scr.prec, i)
+		right.Mul(right, scr.step[0])
+		right.Mul(right, scr.right[n])
+		ret[n].Add(ret[n], right)
+
+		up := newFromFloat64(scr.prec, j)
+		up.Mul(up, scr.step[1])
+		up.Mul(up, scr.up[n])
+		ret[n].Sub(ret[n], up)
+	}
+
+	if scr.dist != nil {
+		// The distance from the camera grows from dist to dist+k*step along the ray.
+		scale := newFromInt(scr.prec, k)
+		scale.Mul(scale, scr.step[2])
+		scale.Add(scale, scr.dist)
+		scale.Quo(scale, scr.dist)
+		for n := 0; n < 3; n++ {
+			ret[n].Sub(ret[n], scr.eye[n])
+			ret[n].Mul(ret[n], scale)
+			ret[n].Add(ret[n], scr.eye[n])
+		}
+		return ret
+	}
+
+	for n := 0; n < 3; n++ {
+		in := newFromInt(scr.prec, k)
+		in.Mul(in, scr.step[2])
+		in.Mul(in, scr.in[n])
+		ret[n].Add(ret[n], in)
+	}
+	return ret
+}
+
+// Projects world coordinates onto the fractional pixel coordinate (i,j) of the middle layer, the inverse of
+// gridToWorld for k=0. In perspective projection, the point is projected along the ray from the camera, and false is
+// returned if it is behind the camera.
+func (scr *screen) worldToPixel(p [3]float64) (float64, float64, bool) {
+	var nw, right, up, in, eye [3]float64
+	for n := 0; n < 3; n++ {
+		nw[n], _ = scr.nw[n].Float64()
+		right[n], _ = scr.right[n].Float64()
+		up[n], _ = scr.up[n].Float64()
+		in[n], _ = scr.in[n].Float64()
+	}
+	if scr.dist != nil {
+		dist, _ := scr.dist.Float64()
+		for n := 0; n < 3; n++ {
+			eye[n], _ = scr.eye[n].Float64()
+		}
+		rel := sub(p, eye)
+		depth := dot(rel, in)
+		if depth <= 0 {
+			return 0, 0, false
+		}
+		for n := 0; n < 3; n++ {
+			p[n] = eye[n] + rel[n]*dist/depth
+		}
+	}
+	step, _ := scr.step[0].Float64()
+	d := sub(p, nw)
+	return dot(d, right) / step, -dot(d, up) / step, true
+}
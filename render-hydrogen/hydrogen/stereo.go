@@ -0,0 +1,70 @@
+package hydrogen
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Camera angles of one view, in radians.
+type view struct {
+	// Azimuth of the camera, i.e., cameraPhi unless turning on the turntable.
+	phi float64
+	// Rotation of the camera around lookAt about the up vector of the screen, positive moving it to the left.
+	yaw float64
+}
+
+// Returns the views of all frames: the steps of the turntable, each with the left then the right eye for stereo.
+func (cfg *Config) views() []view {
+	steps := 1
+	if cfg.Turntable != nil {
+		steps = cfg.Turntable.Frames
+	}
+	var views []view
+	for s := 0; s < steps; s++ {
+		phi := cfg.CameraPhi + 2*math.Pi*float64(s)/float64(steps)
+		if cfg.Stereo == nil {
+			views = append(views, view{phi: phi})
+			continue
+		}
+		half := cfg.Stereo.Separation / 2
+		views = append(views, view{phi: phi, yaw: half}, view{phi: phi, yaw: -half})
+	}
+	return views
+}
+
+// Returns the output images from the colorized frames of the given number of times, one per turntable step or time,
+// each merging the stereo pair if any.
+func composeImages(cfg *Config, imgs []*image.RGBA, times int) []*image.RGBA {
+	if cfg.Stereo == nil {
+		return imgs
+	}
+	out := make([]*image.RGBA, len(imgs)/2)
+	for o := range out {
+		s, t := o/times, o%times
+		out[o] = stereoImage(cfg.Stereo.Mode, imgs[2*s*times+t], imgs[(2*s+1)*times+t])
+	}
+	return out
+}
+
+// Merges the images of the left and right eye.
+func stereoImage(mode string, left, right *image.RGBA) *image.RGBA {
+	size := left.Bounds().Dx()
+	if mode == sideBySideStereo {
+		img := image.NewRGBA(image.Rect(0, 0, 2*size, size))
+		draw.Draw(img, left.Bounds(), left, image.Point{}, draw.Src)
+		draw.Draw(img, left.Bounds().Add(image.Pt(size, 0)), right, image.Point{}, draw.Src)
+		return img
+	}
+	// Half-color anaglyph: the red channel carries the luminance of the left image so that the red filter passes all
+	// of it, while the green and blue channels keep the colors of the right image.
+	img := image.NewRGBA(left.Bounds())
+	for p := 0; p < len(img.Pix); p += 4 {
+		lum := 0.299*float64(left.Pix[p]) + 0.587*float64(left.Pix[p+1]) + 0.114*float64(left.Pix[p+2])
+		img.Pix[p] = uint8(math.Round(lum))
+		img.Pix[p+1] = right.Pix[p+1]
+		img.Pix[p+2] = right.Pix[p+2]
+		img.Pix[p+3] = 0xff
+	}
+	return img
+}
@@ -0,0 +1,252 @@
+package hydrogen
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Returns the configs of all jobs of the sweep, each parsed from the config file content without the sweep, with its
+// own fields replaced.
+func sweepJobs(cfg *Config) ([]*Config, error) {
+	base := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(cfg.source, &base); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	delete(base, "sweep")
+	job := func(fields map[string]interface{}, overrides map[string]json.RawMessage) (*Config, error) {
+		merged := make(map[string]json.RawMessage)
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k], _ = json.Marshal(v)
+		}
+		for k, v := range overrides {
+			merged[k] = v
+		}
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return nil, err
+		}
+		jobCfg, err := ParseConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		if jobCfg, err = jobCfg.validated(); err != nil {
+			return nil, err
+		}
+		if cfg.Log != nil {
+			jobCfg.Log = sweepLog{w: cfg.Log}
+		}
+		jobCfg.quiet = true
+		return jobCfg, jobCfg.resolveAuto()
+	}
+
+	sw := cfg.Sweep
+	ext := filepath.Ext(cfg.OutputFile)
+	prefix := strings.TrimSuffix(cfg.OutputFile, ext)
+	var jobs []*Config
+	for _, n := range sw.N {
+		for l := 0; l < n; l++ {
+			if len(sw.L) > 0 && !containsInt(sw.L, l) {
+				continue
+			}
+			for m := -l; m <= l; m++ {
+				if len(sw.M) > 0 && !containsInt(sw.M, m) {
+					continue
+				}
+				// E.g., outputs/sweep.png becomes outputs/sweep-4-2--1.png for (4,2,-1).
+				output := fmt.Sprintf("%v-%v-%v-%v%v", prefix, n, l, m, ext)
+				jobCfg, err := job(map[string]interface{}{"n": n, "l": l, "m": m, "outputFile": output}, nil)
+				if err != nil {
+					return nil, err
+				}
+				jobs = append(jobs, jobCfg)
+			}
+		}
+	}
+	for k, overrides := range sw.Overrides {
+		// The output is numbered unless overridden, e.g., outputs/sweep.png becomes outputs/sweep-0003.png for k=3.
+		jobCfg, err := job(map[string]interface{}{"outputFile": frameFile(cfg.OutputFile, k)}, overrides)
+		if err != nil {
+			return nil, err
+		}
+		field := fmt.Sprintf("sweep.overrides[%v]", k)
+		if jobCfg.Animation != nil || jobCfg.Turntable != nil || len(jobCfg.Panels) > 0 {
+			return nil, fieldError(field,
+				fmt.Sprintf("invalid %v: sweep cannot be combined with animation, turntable or panels", field))
+		}
+		if jobCfg.CheckpointFile != "" || jobCfg.RawOutput != nil || jobCfg.Preview != nil {
+			return nil, fieldError(field,
+				fmt.Sprintf("invalid %v: sweep cannot be combined with checkpointFile, rawOutput or preview", field))
+		}
+		jobs = append(jobs, jobCfg)
+	}
+	return jobs, nil
+}
+
+// Writer of the log of the jobs of a sweep, which clears the progress bar of the sweep before each line, for the next
+// progress update to redraw it below.
+type sweepLog struct {
+	w io.Writer
+}
+
+func (sl sweepLog) Write(p []byte) (int, error) {
+	// A single write, so that the progress bar cannot update in between.
+	if _, err := sl.w.Write(append([]byte("\r       \r"), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Renders all jobs of the sweep, with one pool of cfg.Concurrency workers taking the pixel columns of all jobs in turn,
+// then writes the contact sheet. Each job is written and its frames released as soon as all of its columns are done,
+// one job at a time, so that only the jobs in progress are held in memory. Stops early with the error once ctx is done.
+func runSweep(ctx context.Context, cfg *Config) error {
+	jobs, err := sweepJobs(cfg)
+	if err != nil {
+		return err
+	}
+	cfg.logf("sweeping %v jobs\n", len(jobs))
+	renderers := make([]*renderer, len(jobs))
+	total := 0
+	for k, job := range jobs {
+		rd, err := newRenderer(job, []float64{0})
+		if err != nil {
+			return fmt.Errorf("%v: %w", job.OutputFile, err)
+		}
+		renderers[k] = rd
+		total += job.ImageSize * job.ImageSize * rd.samples * rd.samples * len(rd.views) * len(rd.layerIndices())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The frames of a job are allocated once its columns are queued.
+	frames := make([][]*frame, len(jobs))
+	remaining := make([]int64, len(jobs))
+	escalated := make([]int64, len(jobs))
+	for k, job := range jobs {
+		remaining[k] = int64(job.ImageSize)
+	}
+	// Writes the jobs whose columns are all done in turn, and releases them.
+	completed := make(chan int, len(jobs))
+	finished := make(chan error, 1)
+	go func() {
+		for k := range completed {
+			rd := renderers[k]
+			rd.cfg.logf("%v: %v\n", rd.cfg.OutputFile, stateLabel(rd.cfg))
+			if err := rd.finish(ctx, frames[k], int(atomic.LoadInt64(&escalated[k]))); err != nil {
+				cancel()
+				// The remaining jobs are dropped.
+				for range completed {
+				}
+				finished <- err
+				return
+			}
+			frames[k], renderers[k] = nil, nil
+		}
+		finished <- nil
+	}()
+
+	type column struct{ job, i int }
+	columns := make(chan column)
+	var wg, progressWg sync.WaitGroup
+	ch := showProgress(cfg, total, &progressWg)
+	wg.Add(cfg.Concurrency)
+	for w := 0; w < cfg.Concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for col := range columns {
+				if ctx.Err() != nil {
+					continue
+				}
+				rd, fr := renderers[col.job], frames[col.job]
+				for j := 0; j < rd.cfg.ImageSize; j++ {
+					px := rd.pixel(col.i, j, ch)
+					rd.store(fr, col.i, j, px)
+					if px.escalated {
+						atomic.AddInt64(&escalated[col.job], 1)
+					}
+				}
+				if atomic.AddInt64(&remaining[col.job], -1) == 0 {
+					completed <- col.job
+				}
+			}
+		}()
+	}
+feed:
+	for k, job := range jobs {
+		frames[k] = renderers[k].newFrames()
+		for i := 0; i < job.ImageSize; i++ {
+			select {
+			case columns <- column{job: k, i: i}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(columns)
+	wg.Wait()
+	close(completed)
+	finishErr := <-finished
+	close(ch)
+	progressWg.Wait()
+	if finishErr != nil {
+		return finishErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := writeIndex(cfg.Sweep.IndexFile, jobs); err != nil {
+		return err
+	}
+	cfg.logf("contact sheet of %v jobs written to %v\n", len(jobs), cfg.Sweep.IndexFile)
+	return nil
+}
+
+// Writes the HTML contact sheet showing the output of each job with its state, linked relative to the sheet.
+func writeIndex(filename string, jobs []*Config) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>render-hydrogen sweep</title>\n")
+	fmt.Fprintf(w, "<style>body { background: #111; color: #ddd; font-family: sans-serif; } ")
+	fmt.Fprintf(w, "figure { display: inline-block; margin: 8px; text-align: center; } img { width: 240px; }</style>\n")
+	fmt.Fprintf(w, "</head>\n<body>\n")
+	for _, job := range jobs {
+		src, err := filepath.Rel(filepath.Dir(filename), job.OutputFile)
+		if err != nil {
+			src = job.OutputFile
+		}
+		src = html.EscapeString(filepath.ToSlash(src))
+		fmt.Fprintf(w, "<figure><a href=\"%v\"><img src=\"%v\"></a><figcaption>%v</figcaption></figure>\n",
+			src, src, html.EscapeString(stateLabel(job)))
+	}
+	fmt.Fprintf(w, "</body>\n</html>\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,107 +1,52 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"image"
-	"image/color"
-	"image/png"
-	"math"
-	"math/big"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
+
+	"github.com/euphoricrhino/sakurai-go/render-hydrogen/hydrogen"
 )
 
 func main() {
 	var configFile string
+	var opts hydrogen.Options
 	flag.StringVar(&configFile, "config", "", "config file")
+	flag.BoolVar(&opts.Resume, "resume", false,
+		"resume from the checkpoint file of the config, only computing the missing columns")
+	flag.StringVar(&opts.Coordinator, "coordinator", "",
+		"listen on this address and farm out tiles to workers instead of rendering locally")
+	flag.StringVar(&opts.Worker, "worker", "", "render tiles for the coordinator at this address, with the same config")
+	flag.StringVar(&opts.Recolor, "recolor", "",
+		"recolor the raw density from this .npy file with the heatmap, exposure, scale and clipping of the config, "+
+			"without rendering")
+	flag.BoolVar(&opts.Mesh, "mesh", false,
+		"write the isosurface mesh configured by the isosurface section instead of rendering")
+	flag.BoolVar(&opts.Points, "points", false,
+		"write the point cloud configured by the pointCloud section instead of rendering")
+	flag.Int64Var(&opts.Seed, "seed", 0, "seed of the point cloud sampling, 0 for a random seed")
+	flag.BoolVar(&opts.Preview, "preview", false,
+		"write the preview configured by the preview section, or the default preview without one, instead of rendering")
 	flag.Parse()
 
-	cfg := parseConfigOrDie(configFile)
-
-	setPrecOnce(cfg.FloatPrec)
-
-	scr := newScreen(cfg)
-	eval := newEvaluator(cfg)
-
-	// Data with all layers added together.
-	data := make([]*big.Float, cfg.ImageSize*cfg.ImageSize)
-	var wg sync.WaitGroup
-	wg.Add(cfg.Concurrency + 1)
-
-	ch := make(chan struct{}, cfg.Concurrency)
-
-	// Counting goroutine, will display percentage progress.
+	// The first interrupt cancels the render, which persists the checkpoint, and a second one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	go func() {
-		defer wg.Done()
-		mark := 0
-		cnt := 0
-		total := len(data) * cfg.Layers
-		for cnt < total {
-			<-ch
-			cnt++
-			progress := int(1000.0 * float64(cnt) / float64(total))
-			if progress > mark {
-				mark = progress
-				fmt.Printf("\r       \r%03.1f%%", float64(progress)/10.0)
-			}
-		}
-		fmt.Printf("\r       \rdone\n")
+		<-ctx.Done()
+		stop()
 	}()
 
-	// One goroutine per worker, with all workers partitioning the i-index space.
-	for w := 0; w < cfg.Concurrency; w++ {
-		go func(shard int) {
-			defer wg.Done()
-			for i := 0; i < cfg.ImageSize; i++ {
-				if i%cfg.Concurrency != shard {
-					continue
-				}
-				for j := 0; j < cfg.ImageSize; j++ {
-					// Recall cfg.Layers must be odd number
-					halfLayers := (cfg.Layers - 1) / 2
-					pixel := blankFloat()
-					for k := -halfLayers; k <= halfLayers; k++ {
-						r := scr.gridToWorld(i, j, k)
-						p := eval.probDensity(r[0], r[1], r[2])
-						pixel.Add(pixel, p)
-						ch <- struct{}{}
-					}
-					// Safe to write since no other worker goroutine will touch the same (i,j).
-					data[j*cfg.ImageSize+i] = pixel
-				}
-			}
-		}(w)
+	cfg, err := hydrogen.ParseConfigFile(configFile)
+	if err == nil {
+		cfg.Log = os.Stdout
+		err = hydrogen.Run(ctx, cfg, opts)
 	}
-
-	wg.Wait()
-
-	// For normalization calculation.
-	max := blankFloat()
-	for i := 0; i < len(data); i++ {
-		if max.Cmp(data[i]) < 0 {
-			max.Set(data[i])
-		}
-	}
-
-	img := image.NewRGBA(image.Rect(0, 0, cfg.ImageSize, cfg.ImageSize))
-	for i := 0; i < cfg.ImageSize; i++ {
-		for j := 0; j < cfg.ImageSize; j++ {
-			pixel := data[j*cfg.ImageSize+i]
-			normalized, _ := blankFloat().Quo(pixel, max).Float64()
-			// Adjust for exposure for best visual contrast.
-			val := math.Pow(normalized, 1.0/float64(cfg.Exposure))
-			heatmapPos := int(val * float64(len(cfg.heatmap)-1))
-			r, g, b, a := cfg.heatmap[heatmapPos].RGBA()
-			img.SetRGBA64(i, j, color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: uint16(a)})
-		}
-	}
-	out, err := os.Create(cfg.OutputFile)
 	if err != nil {
-		panic(err)
-	}
-	defer out.Close()
-	if err := png.Encode(out, img); err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "render-hydrogen: %v\n", err)
+		os.Exit(1)
 	}
 }